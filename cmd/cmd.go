@@ -1,29 +1,45 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/JulienBalestra/kube-csr/pkg/audit"
+	"github.com/JulienBalestra/kube-csr/pkg/exporter"
+	"github.com/JulienBalestra/kube-csr/pkg/inspect"
+	"github.com/JulienBalestra/kube-csr/pkg/list"
 	"github.com/JulienBalestra/kube-csr/pkg/operation"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/approve"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/generate"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/purge"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/query"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/revoke"
 	"github.com/JulienBalestra/kube-csr/pkg/operation/submit"
+	"github.com/JulienBalestra/kube-csr/pkg/reload"
 	"github.com/JulienBalestra/kube-csr/pkg/renew"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/leader"
+	"github.com/JulienBalestra/kube-csr/pkg/verify"
 )
 
 const (
 	programName = "kube-csr"
+	// envPrefix of the environment variables overriding the flags, like KUBE_CSR_PRIVATE_KEY_FILE for --private-key-file
+	envPrefix = "KUBE_CSR"
 )
 
 var (
@@ -32,29 +48,67 @@ var (
 
 // NewCommand creates a cobra command to be consumed in the main package
 func NewCommand() (*cobra.Command, *int) {
-	var verbose int
 	var exitCode int
 
 	rootCommand := &cobra.Command{
 		Use:   programName,
 		Short: "Use this command to manage Kubernetes certificates",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			flag.Lookup("alsologtostderr").Value.Set("true")
-			flag.Lookup("v").Value.Set(strconv.Itoa(verbose))
+			err := loadConfig()
+			if err != nil {
+				cmd.SilenceUsage, cmd.SilenceErrors = true, true
+				return err
+			}
+			flag.Lookup("v").Value.Set(strconv.Itoa(viperConfig.GetInt("verbose")))
+			return nil
 		},
 	}
-	rootCommand.PersistentFlags().IntVarP(&verbose, "verbose", "v", 0, "verbose level")
+	rootCommand.PersistentFlags().IntP("verbose", "v", 0, "verbose level")
+	viperConfig.BindPFlag("verbose", rootCommand.PersistentFlags().Lookup("verbose"))
+
+	rootCommand.PersistentFlags().String("config", "", fmt.Sprintf("config file in YAML, JSON or TOML with the flags as keys, overridden by the %s_* environment variables and the flags", envPrefix))
+	viperConfig.BindPFlag("config", rootCommand.PersistentFlags().Lookup("config"))
+
 	viperConfig.SetDefault("kubeconfig-path", "")
 	rootCommand.PersistentFlags().String("kubeconfig-path", viperConfig.GetString("kubeconfig-path"), "Kubernetes config path, leave empty for inCluster config")
 	viperConfig.BindPFlag("kubeconfig-path", rootCommand.PersistentFlags().Lookup("kubeconfig-path"))
 
+	viperConfig.SetDefault("kubeconfig-env", false)
+	rootCommand.PersistentFlags().Bool("kubeconfig-env", viperConfig.GetBool("kubeconfig-env"), fmt.Sprintf("merge the files of the %s environment variable like kubectl does when --kubeconfig-path is empty", clientcmd.RecommendedConfigPathEnvVar))
+	viperConfig.BindPFlag("kubeconfig-env", rootCommand.PersistentFlags().Lookup("kubeconfig-env"))
+
+	viperConfig.SetDefault("context", "")
+	rootCommand.PersistentFlags().String("context", viperConfig.GetString("context"), "Kubernetes config context to use instead of the current-context")
+	viperConfig.BindPFlag("context", rootCommand.PersistentFlags().Lookup("context"))
+
+	viperConfig.SetDefault("as", "")
+	rootCommand.PersistentFlags().String("as", viperConfig.GetString("as"), "Username to impersonate for the Kubernetes requests")
+	viperConfig.BindPFlag("as", rootCommand.PersistentFlags().Lookup("as"))
+
+	viperConfig.SetDefault("as-group", nil)
+	rootCommand.PersistentFlags().StringSlice("as-group", viperConfig.GetStringSlice("as-group"), "Groups to impersonate with --as comma separated")
+	viperConfig.BindPFlag("as-group", rootCommand.PersistentFlags().Lookup("as-group"))
+
+	viperConfig.SetDefault("kube-api-qps", 0)
+	rootCommand.PersistentFlags().Float32("kube-api-qps", float32(viperConfig.GetFloat64("kube-api-qps")), "Maximum queries per second to the kube-apiserver, 0 for the client default")
+	viperConfig.BindPFlag("kube-api-qps", rootCommand.PersistentFlags().Lookup("kube-api-qps"))
+
+	viperConfig.SetDefault("kube-api-burst", 0)
+	rootCommand.PersistentFlags().Int("kube-api-burst", viperConfig.GetInt("kube-api-burst"), "Maximum burst of queries to the kube-apiserver, 0 for the client default")
+	viperConfig.BindPFlag("kube-api-burst", rootCommand.PersistentFlags().Lookup("kube-api-burst"))
+
+	viperConfig.SetDefault("kube-api-timeout", kubeclient.DefaultTimeout)
+	rootCommand.PersistentFlags().Duration("kube-api-timeout", viperConfig.GetDuration("kube-api-timeout"), "Timeout of each request to the kube-apiserver")
+	viperConfig.BindPFlag("kube-api-timeout", rootCommand.PersistentFlags().Lookup("kube-api-timeout"))
+
 	garbageCommandName := fmt.Sprintf("%s gc", programName)
 	garbageCommand := &cobra.Command{
 		Use:        "garbage-collect",
 		Args:       cobra.ExactArgs(0),
 		Aliases:    []string{"gc"},
 		SuggestFor: []string{"purge", "delete", "remove", "del", "rm"},
-		Short:      "Garbage collect Kubernetes certificates on different parameters",
+		Short:      fmt.Sprintf("Garbage collect Kubernetes certificates on different parameters, the revoked csr and the ones annotated %s=true are kept", purge.KubeCSRRetainAnnotation),
 		Example: fmt.Sprintf(`
 # Garbage collect all csr already fetched with a grace period of 12 hours
 %s --fetched --grace-period=12h
@@ -65,19 +119,48 @@ func NewCommand() (*cobra.Command, *int) {
 # Garbage collect now all csr already fetched
 %s --fetched --grace-period=0s
 
+# Garbage collect the csr already fetched of the nodes only
+%s --fetched --requestor system:nodes --name-prefix node-csr-
+
+# Keep the 3 most recent issued csr of each common name
+%s --keep-last 3
+
+# Report as JSON the csr denied or expired without deleting them
+%s --denied --expired --dry-run --output json
+
+# Delete at most 100 csr per run, 5 per second
+%s --denied --max-deletes-per-run 100 --delete-qps 5
+
 # Garbage collect every 10min all csr already fetched with a grace period of 1 hour
 %s --fetched --daemon polling-period=10m --grace-period=1h
+
+# Run several replicas of the gc daemon, only the leader garbage collects
+%s --fetched --daemon --leader-elect --leader-elect-namespace kube-system
 `,
 			garbageCommandName,
 			garbageCommandName,
 			garbageCommandName,
 			garbageCommandName,
+			garbageCommandName,
+			garbageCommandName,
+			garbageCommandName,
+			garbageCommandName,
+			garbageCommandName,
 		),
 		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
 			if !viperConfig.GetBool("denied") &&
 				!viperConfig.GetBool("fetched") &&
-				!viperConfig.GetBool("expired") {
-				glog.Errorf("Must choose at least one flag: --denied, --fetched, --expired")
+				!viperConfig.GetBool("expired") &&
+				!viperConfig.GetBool("pending") &&
+				!viperConfig.GetBool("stuck-approved") &&
+				viperConfig.GetInt("keep-last") <= 0 {
+				glog.Errorf("Must choose at least one flag: --denied, --fetched, --expired, --pending, --stuck-approved, --keep-last")
+				exitCode = 1
+				return
+			}
+			if viperConfig.GetBool("dry-run") && viperConfig.GetBool("daemon") {
+				glog.Errorf("Cannot use --dry-run with --daemon")
 				exitCode = 1
 				return
 			}
@@ -86,10 +169,25 @@ func NewCommand() (*cobra.Command, *int) {
 				exitCode = 1
 				return
 			}
+			ctx, cancel := newSignalContext()
+			defer cancel()
+			if viperConfig.GetBool("dry-run") {
+				candidates, err := gc.DryRun(ctx)
+				if err != nil {
+					exitCode = 2
+					return
+				}
+				err = purge.WriteReport(os.Stdout, candidates, viperConfig.GetString("output"))
+				if err != nil {
+					glog.Errorf("Cannot write the report: %v", err)
+					exitCode = 1
+				}
+				return
+			}
 			if viperConfig.GetBool("daemon") {
-				err = gc.GarbageCollectLoop()
+				err = gc.GarbageCollectLoop(ctx)
 			} else {
-				err = gc.GarbageCollect()
+				err = gc.GarbageCollect(ctx)
 			}
 			if err != nil {
 				exitCode = 2
@@ -117,6 +215,72 @@ func NewCommand() (*cobra.Command, *int) {
 	garbageCommand.PersistentFlags().Bool("expired", viperConfig.GetBool("expired"), fmt.Sprintf("delete any Kubernetes csr with an expired certificate"))
 	viperConfig.BindPFlag("expired", garbageCommand.PersistentFlags().Lookup("expired"))
 
+	viperConfig.SetDefault("keep-last", 0)
+	garbageCommand.PersistentFlags().Int("keep-last", viperConfig.GetInt("keep-last"), "delete any Kubernetes csr older than the N most recent issued ones with the same common name, after the grace period")
+	viperConfig.BindPFlag("keep-last", garbageCommand.PersistentFlags().Lookup("keep-last"))
+
+	viperConfig.SetDefault("keep-last-group-label", "")
+	garbageCommand.PersistentFlags().String("keep-last-group-label", viperConfig.GetString("keep-last-group-label"), "group the Kubernetes csr of --keep-last by the value of this label instead of the common name")
+	viperConfig.BindPFlag("keep-last-group-label", garbageCommand.PersistentFlags().Lookup("keep-last-group-label"))
+
+	// gc scope
+	viperConfig.SetDefault("selector", "")
+	garbageCommand.PersistentFlags().StringP("selector", "l", viperConfig.GetString("selector"), "only consider the Kubernetes csr matching this label selector")
+
+	viperConfig.SetDefault("name-prefix", "")
+	garbageCommand.PersistentFlags().String("name-prefix", viperConfig.GetString("name-prefix"), "only consider the Kubernetes csr with a name starting with this prefix")
+	viperConfig.BindPFlag("name-prefix", garbageCommand.PersistentFlags().Lookup("name-prefix"))
+
+	viperConfig.SetDefault("requestor", nil)
+	garbageCommand.PersistentFlags().StringSlice("requestor", viperConfig.GetStringSlice("requestor"), "only consider the Kubernetes csr requested by one of these usernames or groups comma separated")
+	viperConfig.BindPFlag("requestor", garbageCommand.PersistentFlags().Lookup("requestor"))
+
+	// throttling
+	viperConfig.SetDefault("list-page-size", 500)
+	garbageCommand.PersistentFlags().Int64("list-page-size", viperConfig.GetInt64("list-page-size"), "number of Kubernetes csr listed per request, 0 lists all the csr at once")
+	viperConfig.BindPFlag("list-page-size", garbageCommand.PersistentFlags().Lookup("list-page-size"))
+
+	viperConfig.SetDefault("max-deletes-per-run", 0)
+	garbageCommand.PersistentFlags().Int("max-deletes-per-run", viperConfig.GetInt("max-deletes-per-run"), "stop each gc call after this number of deletes, the next one resumes where it stopped, 0 for unlimited")
+	viperConfig.BindPFlag("max-deletes-per-run", garbageCommand.PersistentFlags().Lookup("max-deletes-per-run"))
+
+	viperConfig.SetDefault("delete-qps", 0.0)
+	garbageCommand.PersistentFlags().Float64("delete-qps", viperConfig.GetFloat64("delete-qps"), "maximum number of Kubernetes csr deleted per second, 0 for unlimited")
+	viperConfig.BindPFlag("delete-qps", garbageCommand.PersistentFlags().Lookup("delete-qps"))
+
+	// archive
+	viperConfig.SetDefault("archive-file", "")
+	garbageCommand.PersistentFlags().String("archive-file", viperConfig.GetString("archive-file"), "append each Kubernetes csr and its certificate as a JSON line to this file before deleting it")
+	viperConfig.BindPFlag("archive-file", garbageCommand.PersistentFlags().Lookup("archive-file"))
+
+	viperConfig.SetDefault("archive-configmap", "")
+	garbageCommand.PersistentFlags().String("archive-configmap", viperConfig.GetString("archive-configmap"), fmt.Sprintf("store each Kubernetes csr and its certificate in the configmaps namespace/name labeled %s=name before deleting it", purge.KubeCSRArchiveLabel))
+	viperConfig.BindPFlag("archive-configmap", garbageCommand.PersistentFlags().Lookup("archive-configmap"))
+
+	viperConfig.SetDefault("archive-max-size", purge.ConfigMapArchiveMaxSize)
+	garbageCommand.PersistentFlags().Int64("archive-max-size", viperConfig.GetInt64("archive-max-size"), fmt.Sprintf("size in bytes of the archive file or configmap before its rotation, at most %d for a configmap", purge.ConfigMapArchiveMaxSize))
+	viperConfig.BindPFlag("archive-max-size", garbageCommand.PersistentFlags().Lookup("archive-max-size"))
+
+	viperConfig.SetDefault("archive-max-backups", 10)
+	garbageCommand.PersistentFlags().Int("archive-max-backups", viperConfig.GetInt("archive-max-backups"), "number of rotated archive files or configmaps to keep, the records of the older ones are dropped")
+	viperConfig.BindPFlag("archive-max-backups", garbageCommand.PersistentFlags().Lookup("archive-max-backups"))
+
+	// dry run
+	viperConfig.SetDefault("dry-run", false)
+	garbageCommand.PersistentFlags().Bool("dry-run", viperConfig.GetBool("dry-run"), "report the Kubernetes csr matched by the gc functions without deleting them")
+	viperConfig.BindPFlag("dry-run", garbageCommand.PersistentFlags().Lookup("dry-run"))
+
+	// the default of the shared output depends on the command
+	garbageCommand.PersistentFlags().StringP("output", "o", purge.ReportFormatTable, fmt.Sprintf("format of the --dry-run report: %s or %s", purge.ReportFormatTable, purge.ReportFormatJSON))
+
+	viperConfig.SetDefault("pending", false)
+	garbageCommand.PersistentFlags().Bool("pending", viperConfig.GetBool("pending"), "delete any Kubernetes csr never approved nor denied since its creation")
+	viperConfig.BindPFlag("pending", garbageCommand.PersistentFlags().Lookup("pending"))
+
+	viperConfig.SetDefault("stuck-approved", false)
+	garbageCommand.PersistentFlags().Bool("stuck-approved", viperConfig.GetBool("stuck-approved"), "delete any Kubernetes csr approved without certificate issued since its approval")
+	viperConfig.BindPFlag("stuck-approved", garbageCommand.PersistentFlags().Lookup("stuck-approved"))
+
 	// daemon flags
 	pollingPeriod, daemon := "polling-period", "daemon"
 	viperConfig.SetDefault(pollingPeriod, time.Minute*10)
@@ -127,13 +291,32 @@ func NewCommand() (*cobra.Command, *int) {
 	garbageCommand.PersistentFlags().Bool(daemon, viperConfig.GetBool(daemon), fmt.Sprintf("continually gc Kubernetes csr, paired with --%s", pollingPeriod))
 	viperConfig.BindPFlag(daemon, garbageCommand.PersistentFlags().Lookup(daemon))
 
+	// daemon - leader election
+	viperConfig.SetDefault("leader-elect", false)
+	garbageCommand.PersistentFlags().Bool("leader-elect", viperConfig.GetBool("leader-elect"), fmt.Sprintf("run the gc loop only on the elected leader, the other replicas stand by, paired with --%s", daemon))
+	viperConfig.BindPFlag("leader-elect", garbageCommand.PersistentFlags().Lookup("leader-elect"))
+
+	viperConfig.SetDefault("leader-elect-identity", "")
+	garbageCommand.PersistentFlags().String("leader-elect-identity", viperConfig.GetString("leader-elect-identity"), "identity of the replica in the leader election, leave empty for the hostname")
+	viperConfig.BindPFlag("leader-elect-identity", garbageCommand.PersistentFlags().Lookup("leader-elect-identity"))
+
+	viperConfig.SetDefault("leader-elect-namespace", "kube-system")
+	garbageCommand.PersistentFlags().String("leader-elect-namespace", viperConfig.GetString("leader-elect-namespace"), "namespace of the leader election lock configmap")
+	viperConfig.BindPFlag("leader-elect-namespace", garbageCommand.PersistentFlags().Lookup("leader-elect-namespace"))
+
+	viperConfig.SetDefault("leader-elect-name", "kube-csr-gc")
+	garbageCommand.PersistentFlags().String("leader-elect-name", viperConfig.GetString("leader-elect-name"), fmt.Sprintf("name of the leader election lock configmap, the lease is stored with the kube-annotation %q", leader.LeaderAnnotation))
+	viperConfig.BindPFlag("leader-elect-name", garbageCommand.PersistentFlags().Lookup("leader-elect-name"))
+
+	viperConfig.SetDefault("leader-elect-lease-duration", time.Second*15)
+	garbageCommand.PersistentFlags().Duration("leader-elect-lease-duration", viperConfig.GetDuration("leader-elect-lease-duration"), "duration the followers wait after the last renew of the leader before acquiring the leadership")
+	viperConfig.BindPFlag("leader-elect-lease-duration", garbageCommand.PersistentFlags().Lookup("leader-elect-lease-duration"))
+
 	viperConfig.SetDefault("disable-prometheus-exporter", false)
-	garbageCommand.PersistentFlags().Bool("disable-prometheus-exporter", viperConfig.GetBool("disable-prometheus-exporter"), fmt.Sprintf("disable /metrics, paired with --%s", daemon))
-	viperConfig.BindPFlag("disable-prometheus-exporter", garbageCommand.PersistentFlags().Lookup("disable-prometheus-exporter"))
+	garbageCommand.PersistentFlags().Bool("disable-prometheus-exporter", viperConfig.GetBool("disable-prometheus-exporter"), fmt.Sprintf("disable /metrics, /healthz and /readyz, paired with --%s", daemon))
 
 	viperConfig.SetDefault("prometheus-exporter-bind", "0.0.0.0:8484")
-	garbageCommand.PersistentFlags().Bool("prometheus-exporter-bind", viperConfig.GetBool("prometheus-exporter-bind"), fmt.Sprintf("prometheus exporter bind address, paired with --%s", daemon))
-	viperConfig.BindPFlag("prometheus-exporter-bind", garbageCommand.PersistentFlags().Lookup("prometheus-exporter-bind"))
+	garbageCommand.PersistentFlags().String("prometheus-exporter-bind", viperConfig.GetString("prometheus-exporter-bind"), fmt.Sprintf("prometheus exporter, /healthz and /readyz bind address, paired with --%s", daemon))
 
 	// issue command
 	issueCommandName := fmt.Sprintf("%s issue", programName)
@@ -183,6 +366,7 @@ func NewCommand() (*cobra.Command, *int) {
 			issueCommandName,
 		),
 		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
 			if !viperConfig.GetBool("generate") &&
 				!viperConfig.GetBool("renew") &&
 				!viperConfig.GetBool("submit") &&
@@ -213,7 +397,7 @@ func NewCommand() (*cobra.Command, *int) {
 			var fetcher *fetch.Fetch
 			var purger *purge.Purge
 
-			svcToQuery := viperConfig.GetStringSlice("query-svc")
+			svcToQuery := getStringSlice("query-svc")
 			if len(svcToQuery) > 0 {
 				querier, err = newQuery(svcToQuery)
 				if err != nil {
@@ -264,8 +448,10 @@ func NewCommand() (*cobra.Command, *int) {
 					Purge:        purger,
 				},
 			)
+			ctx, cancel := newSignalContext()
+			defer cancel()
 			if !viperConfig.GetBool("renew") {
-				err = op.Run()
+				err = op.Run(ctx)
 				if err != nil {
 					glog.Errorf("Unexpected error: %v", err)
 					exitCode = 2
@@ -278,7 +464,8 @@ func NewCommand() (*cobra.Command, *int) {
 				exitCode = 1
 				return
 			}
-			err = re.Renew()
+			go forceRenewOnSignal(ctx, re)
+			err = re.Renew(ctx)
 			if err != nil {
 				glog.Errorf("Unexpected error: %v", err)
 				exitCode = 2
@@ -385,7 +572,7 @@ func NewCommand() (*cobra.Command, *int) {
 
 	// renew
 	viperConfig.SetDefault("renew", false)
-	issueCommand.PersistentFlags().Bool("renew", viperConfig.GetBool("renew"), "Renew")
+	issueCommand.PersistentFlags().Bool("renew", viperConfig.GetBool("renew"), "Renew, a SIGUSR1 or a POST /renew on the --renew-force-bind address forces an immediate renew")
 	viperConfig.BindPFlag("renew", issueCommand.PersistentFlags().Lookup("renew"))
 
 	viperConfig.SetDefault("renew-exit", false)
@@ -396,6 +583,51 @@ func NewCommand() (*cobra.Command, *int) {
 	issueCommand.PersistentFlags().String("renew-command", viperConfig.GetString("renew-command"), "Command to execute after a successful renew (using /bin/sh as interpreter)")
 	viperConfig.BindPFlag("renew-command", issueCommand.PersistentFlags().Lookup("renew-command"))
 
+	viperConfig.SetDefault("renew-command-policy", renew.HookPolicyFail)
+	issueCommand.PersistentFlags().String("renew-command-policy", viperConfig.GetString("renew-command-policy"), fmt.Sprintf("Policy on failure of the --renew-command: %s, %s or %s", renew.HookPolicyFail, renew.HookPolicyRetry, renew.HookPolicyIgnore))
+	viperConfig.BindPFlag("renew-command-policy", issueCommand.PersistentFlags().Lookup("renew-command-policy"))
+
+	viperConfig.SetDefault("renew-pre-command", "")
+	issueCommand.PersistentFlags().String("renew-pre-command", viperConfig.GetString("renew-pre-command"), "Command to execute before a renew (using /bin/sh as interpreter)")
+	viperConfig.BindPFlag("renew-pre-command", issueCommand.PersistentFlags().Lookup("renew-pre-command"))
+
+	viperConfig.SetDefault("renew-pre-command-policy", renew.HookPolicyFail)
+	issueCommand.PersistentFlags().String("renew-pre-command-policy", viperConfig.GetString("renew-pre-command-policy"), fmt.Sprintf("Policy on failure of the --renew-pre-command: %s, %s or %s", renew.HookPolicyFail, renew.HookPolicyRetry, renew.HookPolicyIgnore))
+	viperConfig.BindPFlag("renew-pre-command-policy", issueCommand.PersistentFlags().Lookup("renew-pre-command-policy"))
+
+	viperConfig.SetDefault("renew-command-timeout", time.Minute)
+	issueCommand.PersistentFlags().Duration("renew-command-timeout", viperConfig.GetDuration("renew-command-timeout"), "Timeout of each execution of the --renew-command and --renew-pre-command")
+	viperConfig.BindPFlag("renew-command-timeout", issueCommand.PersistentFlags().Lookup("renew-command-timeout"))
+
+	viperConfig.SetDefault("renew-command-retries", 3)
+	issueCommand.PersistentFlags().Int("renew-command-retries", viperConfig.GetInt("renew-command-retries"), fmt.Sprintf("Number of retries of the --renew-command and --renew-pre-command with the %s policy", renew.HookPolicyRetry))
+	viperConfig.BindPFlag("renew-command-retries", issueCommand.PersistentFlags().Lookup("renew-command-retries"))
+
+	// renew - reload
+	viperConfig.SetDefault("reload-signal", "SIGHUP")
+	issueCommand.PersistentFlags().String("reload-signal", viperConfig.GetString("reload-signal"), "Signal sent to the processes to reload after a successful renew, paired with --reload-pid-file or --reload-process-name")
+	viperConfig.BindPFlag("reload-signal", issueCommand.PersistentFlags().Lookup("reload-signal"))
+
+	viperConfig.SetDefault("reload-pid-file", "")
+	issueCommand.PersistentFlags().String("reload-pid-file", viperConfig.GetString("reload-pid-file"), "Send the --reload-signal to the process of this pid file after a successful renew")
+	viperConfig.BindPFlag("reload-pid-file", issueCommand.PersistentFlags().Lookup("reload-pid-file"))
+
+	viperConfig.SetDefault("reload-process-name", "")
+	issueCommand.PersistentFlags().String("reload-process-name", viperConfig.GetString("reload-process-name"), "Send the --reload-signal to the processes with this name after a successful renew, requires a shared process namespace")
+	viperConfig.BindPFlag("reload-process-name", issueCommand.PersistentFlags().Lookup("reload-process-name"))
+
+	viperConfig.SetDefault("reload-http-url", "")
+	issueCommand.PersistentFlags().String("reload-http-url", viperConfig.GetString("reload-http-url"), "Call this localhost url after a successful renew, e.g. http://127.0.0.1:8080/reload")
+	viperConfig.BindPFlag("reload-http-url", issueCommand.PersistentFlags().Lookup("reload-http-url"))
+
+	viperConfig.SetDefault("reload-http-method", "POST")
+	issueCommand.PersistentFlags().String("reload-http-method", viperConfig.GetString("reload-http-method"), "HTTP method used with --reload-http-url")
+	viperConfig.BindPFlag("reload-http-method", issueCommand.PersistentFlags().Lookup("reload-http-method"))
+
+	viperConfig.SetDefault("reload-timeout", time.Second*10)
+	issueCommand.PersistentFlags().Duration("reload-timeout", viperConfig.GetDuration("reload-timeout"), "Timeout of each reload action")
+	viperConfig.BindPFlag("reload-timeout", issueCommand.PersistentFlags().Lookup("reload-timeout"))
+
 	viperConfig.SetDefault("renew-threshold", time.Hour)
 	issueCommand.PersistentFlags().Duration("renew-threshold", viperConfig.GetDuration("renew-threshold"), "Renew expiration threshold")
 	viperConfig.BindPFlag("renew-threshold", issueCommand.PersistentFlags().Lookup("renew-threshold"))
@@ -404,14 +636,515 @@ func NewCommand() (*cobra.Command, *int) {
 	issueCommand.PersistentFlags().Duration("renew-check-interval", viperConfig.GetDuration("renew-check-interval"), "Interval between check of the certificate expiration")
 	viperConfig.BindPFlag("renew-check-interval", issueCommand.PersistentFlags().Lookup("renew-check-interval"))
 
-	issueCommand.PersistentFlags().Bool("disable-prometheus-exporter", viperConfig.GetBool("disable-prometheus-exporter"), "disable /metrics, paired with --renew")
-	viperConfig.BindPFlag("disable-prometheus-exporter", garbageCommand.PersistentFlags().Lookup("disable-prometheus-exporter"))
+	viperConfig.SetDefault("renew-at-lifetime-fraction", 0)
+	issueCommand.PersistentFlags().Float64("renew-at-lifetime-fraction", viperConfig.GetFloat64("renew-at-lifetime-fraction"), "Renew once this fraction of the certificate lifetime (NotAfter - NotBefore) is elapsed, overrides --renew-threshold when positive, e.g. 0.66")
+	viperConfig.BindPFlag("renew-at-lifetime-fraction", issueCommand.PersistentFlags().Lookup("renew-at-lifetime-fraction"))
+
+	viperConfig.SetDefault("renew-jitter", 0)
+	issueCommand.PersistentFlags().Float64("renew-jitter", viperConfig.GetFloat64("renew-jitter"), "Randomize the renew threshold and the check interval by +/- this fraction, e.g. 0.1")
+	viperConfig.BindPFlag("renew-jitter", issueCommand.PersistentFlags().Lookup("renew-jitter"))
+
+	viperConfig.SetDefault("renew-retry-delay", time.Second*10)
+	issueCommand.PersistentFlags().Duration("renew-retry-delay", viperConfig.GetDuration("renew-retry-delay"), "Delay before retrying a failed renew, doubled on each consecutive error and shortened as the certificate expiration approaches")
+	viperConfig.BindPFlag("renew-retry-delay", issueCommand.PersistentFlags().Lookup("renew-retry-delay"))
+
+	viperConfig.SetDefault("renew-retry-max-delay", time.Minute*5)
+	issueCommand.PersistentFlags().Duration("renew-retry-max-delay", viperConfig.GetDuration("renew-retry-max-delay"), "Maximum delay before retrying a failed renew")
+	viperConfig.BindPFlag("renew-retry-max-delay", issueCommand.PersistentFlags().Lookup("renew-retry-max-delay"))
+
+	viperConfig.SetDefault("renew-exit-on-expired", false)
+	issueCommand.PersistentFlags().Bool("renew-exit-on-expired", viperConfig.GetBool("renew-exit-on-expired"), "Exit on error when the renew fails with an expired certificate")
+	viperConfig.BindPFlag("renew-exit-on-expired", issueCommand.PersistentFlags().Lookup("renew-exit-on-expired"))
 
-	issueCommand.PersistentFlags().Bool("prometheus-exporter-bind", viperConfig.GetBool("prometheus-exporter-bind"), "prometheus exporter bind address, paired with --renew")
-	viperConfig.BindPFlag("prometheus-exporter-bind", garbageCommand.PersistentFlags().Lookup("prometheus-exporter-bind"))
+	viperConfig.SetDefault("renew-superseded-csr", renew.SupersededCSRDelete)
+	issueCommand.PersistentFlags().String("renew-superseded-csr", viperConfig.GetString("renew-superseded-csr"), fmt.Sprintf("Action on the previous Kubernetes csr once renewed without --override: %s, %s or %s, the library keeps it by default", renew.SupersededCSRKeep, renew.SupersededCSRAnnotate, renew.SupersededCSRDelete))
+	viperConfig.BindPFlag("renew-superseded-csr", issueCommand.PersistentFlags().Lookup("renew-superseded-csr"))
+
+	viperConfig.SetDefault("renew-disable-revocation-watch", false)
+	issueCommand.PersistentFlags().Bool("renew-disable-revocation-watch", viperConfig.GetBool("renew-disable-revocation-watch"), fmt.Sprintf("Disable the watch of the fetched Kubernetes csr, a csr annotated %q is renewed with a new private key", revoke.KubeCSRRevokedTimeAnnotation))
+	viperConfig.BindPFlag("renew-disable-revocation-watch", issueCommand.PersistentFlags().Lookup("renew-disable-revocation-watch"))
+
+	viperConfig.SetDefault("renew-disable-preflight", false)
+	issueCommand.PersistentFlags().Bool("renew-disable-preflight", viperConfig.GetBool("renew-disable-preflight"), "Disable the verify of the private key and csr files and of the certificate permissions before starting the renew")
+	viperConfig.BindPFlag("renew-disable-preflight", issueCommand.PersistentFlags().Lookup("renew-disable-preflight"))
+
+	viperConfig.SetDefault("renew-force-bind", "")
+	issueCommand.PersistentFlags().String("renew-force-bind", viperConfig.GetString("renew-force-bind"), "Loopback bind address serving the POST /renew forcing a renew, e.g. 127.0.0.1:8485, disabled when empty")
+	viperConfig.BindPFlag("renew-force-bind", issueCommand.PersistentFlags().Lookup("renew-force-bind"))
+
+	viperConfig.SetDefault("renew-force-min-interval", time.Minute)
+	issueCommand.PersistentFlags().Duration("renew-force-min-interval", viperConfig.GetDuration("renew-force-min-interval"), "Minimum interval between two renews forced by SIGUSR1 or POST /renew, the ones in between are rejected")
+	viperConfig.BindPFlag("renew-force-min-interval", issueCommand.PersistentFlags().Lookup("renew-force-min-interval"))
+
+	viperConfig.SetDefault("renew-disable-file-watch", false)
+	issueCommand.PersistentFlags().Bool("renew-disable-file-watch", viperConfig.GetBool("renew-disable-file-watch"), "Disable the certificate check on changes of the private key, csr and certificate files")
+	viperConfig.BindPFlag("renew-disable-file-watch", issueCommand.PersistentFlags().Lookup("renew-disable-file-watch"))
+
+	issueCommand.PersistentFlags().Bool("disable-prometheus-exporter", viperConfig.GetBool("disable-prometheus-exporter"), "disable /metrics, /healthz and /readyz, paired with --renew")
+
+	issueCommand.PersistentFlags().String("prometheus-exporter-bind", viperConfig.GetString("prometheus-exporter-bind"), "prometheus exporter, /healthz and /readyz bind address, paired with --renew")
+
+	// revoke command
+	revokeCommandName := fmt.Sprintf("%s revoke", programName)
+	revokeCommand := &cobra.Command{
+		Use:        "revoke [csr-name...]",
+		SuggestFor: []string{"revocation", "compromise", "rotate"},
+		Short:      "Annotate Kubernetes csr as revoked, the renew processes of the csr rotate their private key",
+		Example: fmt.Sprintf(`
+# Revoke a csr
+%s my-app-node-0 --reason "private key leaked"
+
+# Revoke all the csr matching a label selector
+%s --selector app=my-app --reason "private key leaked"
+`,
+			revokeCommandName,
+			revokeCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			selector := viperConfig.GetString("selector")
+			if len(args) == 0 && selector == "" {
+				glog.Errorf("Must choose at least one csr name or --selector")
+				exitCode = 1
+				return
+			}
+			revoker, err := revoke.NewRevoker(newKubeConfig(), &revoke.Config{
+				Reason: viperConfig.GetString("reason"),
+			})
+			if err != nil {
+				exitCode = 1
+				return
+			}
+			for _, csrName := range args {
+				err = revoker.Revoke(csrName)
+				if err != nil {
+					exitCode = 2
+				}
+			}
+			if selector == "" {
+				return
+			}
+			_, err = revoker.RevokeSelector(selector)
+			if err != nil {
+				exitCode = 2
+			}
+		},
+	}
+	rootCommand.AddCommand(revokeCommand)
+
+	viperConfig.SetDefault("reason", "")
+	revokeCommand.PersistentFlags().String("reason", viperConfig.GetString("reason"), fmt.Sprintf("Reason of the revocation, stored with the kube-annotation %q", revoke.KubeCSRRevokedReasonAnnotation))
+	viperConfig.BindPFlag("reason", revokeCommand.PersistentFlags().Lookup("reason"))
+
+	revokeCommand.PersistentFlags().StringP("selector", "l", viperConfig.GetString("selector"), "Revoke the Kubernetes csr matching this label selector")
+
+	// exporter command
+	exporterCommandName := fmt.Sprintf("%s exporter", programName)
+	exporterCommand := &cobra.Command{
+		Use:        "exporter",
+		Args:       cobra.ExactArgs(0),
+		SuggestFor: []string{"export", "monitor", "expiry"},
+		Short:      "Expose the seconds to expiry of the certificates of all Kubernetes csr and the csr by state as prometheus metrics",
+		Example: fmt.Sprintf(`
+# Export the certificates of all the csr
+%s --prometheus-exporter-bind 0.0.0.0:8484
+
+# Export the certificates of the csr matching a label selector
+%s --selector app=my-app
+`,
+			exporterCommandName,
+			exporterCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			e, err := exporter.NewExporter(newKubeConfig(), &exporter.Config{
+				LabelSelector:                 viperConfig.GetString("selector"),
+				ResyncPeriod:                  viperConfig.GetDuration("resync-period"),
+				RefreshPeriod:                 viperConfig.GetDuration("refresh-period"),
+				PrometheusExporterBindAddress: viperConfig.GetString("prometheus-exporter-bind"),
+			})
+			if err != nil {
+				exitCode = 1
+				return
+			}
+			ctx, cancel := newSignalContext()
+			defer cancel()
+			err = e.Run(ctx)
+			if err != nil {
+				exitCode = 2
+			}
+		},
+	}
+	rootCommand.AddCommand(exporterCommand)
+
+	exporterCommand.PersistentFlags().StringP("selector", "l", viperConfig.GetString("selector"), "only export the Kubernetes csr matching this label selector")
+
+	viperConfig.SetDefault("resync-period", time.Minute*10)
+	exporterCommand.PersistentFlags().Duration("resync-period", viperConfig.GetDuration("resync-period"), "duration between each list of all the Kubernetes csr, the changes are watched in between")
+	viperConfig.BindPFlag("resync-period", exporterCommand.PersistentFlags().Lookup("resync-period"))
+
+	viperConfig.SetDefault("refresh-period", time.Second*30)
+	exporterCommand.PersistentFlags().Duration("refresh-period", viperConfig.GetDuration("refresh-period"), "duration between each update of the seconds to expiry of the certificates")
+	viperConfig.BindPFlag("refresh-period", exporterCommand.PersistentFlags().Lookup("refresh-period"))
+
+	exporterCommand.PersistentFlags().String("prometheus-exporter-bind", viperConfig.GetString("prometheus-exporter-bind"), "prometheus exporter and /readyz bind address")
+
+	// audit command
+	auditCommandName := fmt.Sprintf("%s audit", programName)
+	auditCommand := &cobra.Command{
+		Use:        "audit [certificate-glob...]",
+		SuggestFor: []string{"check", "expiry", "scan"},
+		Short:      "Audit the expiry, the private key and the SANs of certificate files and Kubernetes csr",
+		Long: fmt.Sprintf(`Audit the expiry, the private key and the SANs of certificate files and Kubernetes csr.
+
+The private key and the csr of a certificate file are the files with the same name and their own suffix, checked when present.
+The exit code is %d when all the certificates are ok, %d with a warning, %d with a critical certificate and %d when the audit fails.`,
+			audit.ExitOK, audit.ExitWarning, audit.ExitCritical, audit.ExitUnknown),
+		Example: fmt.Sprintf(`
+# Audit the certificate files of a directory, warn 30 days before their expiry
+%s "/etc/ssl/kube-csr/*.certificate" --warning-window 720h
+
+# Audit the certificates issued in the Kubernetes csr as JSON
+%s --cluster --output json
+
+# Audit the certificates issued for an app, they must contain a SAN
+%s --cluster --selector app=my-app --san my-app.default.svc.cluster.local
+`,
+			auditCommandName,
+			auditCommandName,
+			auditCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			a, err := audit.NewAudit(newKubeConfig(), &audit.Config{
+				CertificateGlobs:  args,
+				CertificateSuffix: viperConfig.GetString("certificate-suffix"),
+				PrivateKeySuffix:  viperConfig.GetString("private-key-suffix"),
+				CSRSuffix:         viperConfig.GetString("csr-suffix"),
+				Cluster:           viperConfig.GetBool("cluster"),
+				LabelSelector:     viperConfig.GetString("selector"),
+				WarningWindow:     viperConfig.GetDuration("warning-window"),
+				RequiredSANs:      getStringSlice("san"),
+			})
+			if err != nil {
+				exitCode = audit.ExitUnknown
+				return
+			}
+			findings, err := a.Run()
+			if err != nil {
+				exitCode = audit.ExitUnknown
+				return
+			}
+			err = audit.WriteReport(os.Stdout, findings, viperConfig.GetString("output"))
+			if err != nil {
+				glog.Errorf("Cannot write the report: %v", err)
+				exitCode = audit.ExitUnknown
+				return
+			}
+			exitCode = audit.ExitCode(findings)
+		},
+	}
+	rootCommand.AddCommand(auditCommand)
+
+	viperConfig.SetDefault("cluster", false)
+	auditCommand.PersistentFlags().Bool("cluster", viperConfig.GetBool("cluster"), "audit the certificates issued in the Kubernetes csr")
+	viperConfig.BindPFlag("cluster", auditCommand.PersistentFlags().Lookup("cluster"))
+
+	auditCommand.PersistentFlags().StringP("selector", "l", viperConfig.GetString("selector"), "only audit the Kubernetes csr matching this label selector, paired with --cluster")
+
+	viperConfig.SetDefault("warning-window", time.Hour*24*30)
+	auditCommand.PersistentFlags().Duration("warning-window", viperConfig.GetDuration("warning-window"), "report as warning the certificates expiring within this duration")
+	viperConfig.BindPFlag("warning-window", auditCommand.PersistentFlags().Lookup("warning-window"))
+
+	viperConfig.SetDefault("san", nil)
+	auditCommand.PersistentFlags().StringSlice("san", viperConfig.GetStringSlice("san"), "subject alternative names each certificate must contain comma separated, in addition to the requested ones")
+	viperConfig.BindPFlag("san", auditCommand.PersistentFlags().Lookup("san"))
+
+	viperConfig.SetDefault("certificate-suffix", ".certificate")
+	auditCommand.PersistentFlags().String("certificate-suffix", viperConfig.GetString("certificate-suffix"), "suffix of the certificate files, replaced by the other suffixes to find their private key and csr")
+	viperConfig.BindPFlag("certificate-suffix", auditCommand.PersistentFlags().Lookup("certificate-suffix"))
+
+	viperConfig.SetDefault("private-key-suffix", ".private_key")
+	auditCommand.PersistentFlags().String("private-key-suffix", viperConfig.GetString("private-key-suffix"), "suffix of the private key files matched against the certificates, empty to skip")
+	viperConfig.BindPFlag("private-key-suffix", auditCommand.PersistentFlags().Lookup("private-key-suffix"))
+
+	viperConfig.SetDefault("csr-suffix", ".csr")
+	auditCommand.PersistentFlags().String("csr-suffix", viperConfig.GetString("csr-suffix"), "suffix of the csr files with the SANs requested, empty to skip")
+	viperConfig.BindPFlag("csr-suffix", auditCommand.PersistentFlags().Lookup("csr-suffix"))
+
+	auditCommand.PersistentFlags().StringP("output", "o", audit.ReportFormatText, fmt.Sprintf("format of the report: %s or %s", audit.ReportFormatText, audit.ReportFormatJSON))
+
+	// inspect command
+	inspectCommandName := fmt.Sprintf("%s inspect", programName)
+	inspectCommand := &cobra.Command{
+		Use:        "inspect <file|csr/name>...",
+		Args:       cobra.MinimumNArgs(1),
+		SuggestFor: []string{"decode", "describe", "show", "openssl"},
+		Short:      "Decode the private keys, the certificate requests and the certificates of pem files and Kubernetes csr",
+		Example: fmt.Sprintf(`
+# Decode the files generated by kube-csr
+%s kube-csr.private_key kube-csr.csr kube-csr.certificate
+
+# Decode a Kubernetes csr with its conditions and its kube-csr annotations as JSON
+%s csr/my-app --output json
+`,
+			inspectCommandName,
+			inspectCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			inspector := inspect.NewInspector(newKubeConfig())
+			var inspections []*inspect.Inspection
+			for _, arg := range args {
+				in, err := inspector.Inspect(arg)
+				if err != nil {
+					exitCode = 2
+					continue
+				}
+				inspections = append(inspections, in)
+			}
+			err := inspect.WriteReport(os.Stdout, inspections, viperConfig.GetString("output"))
+			if err != nil {
+				glog.Errorf("Cannot write the report: %v", err)
+				exitCode = 1
+			}
+		},
+	}
+	rootCommand.AddCommand(inspectCommand)
+
+	inspectCommand.PersistentFlags().StringP("output", "o", inspect.ReportFormatText, fmt.Sprintf("format of the report: %s or %s", inspect.ReportFormatText, inspect.ReportFormatJSON))
+
+	// list command
+	listCommandName := fmt.Sprintf("%s list", programName)
+	listCommand := &cobra.Command{
+		Use:        "list",
+		Aliases:    []string{"ls"},
+		Args:       cobra.ExactArgs(0),
+		SuggestFor: []string{"get", "status"},
+		Short:      "List the Kubernetes csr with their common name, SANs, key, condition, fetches, certificate expiry and gc eligibility",
+		Example: fmt.Sprintf(`
+# List all the csr, the certificates expiring first
+%s --sort-by expiry
+
+# List the csr of an app with the requester, the age and the grace period left before their gc
+%s --selector app=my-app -o wide
+
+# List all the csr as YAML
+%s -o yaml
+`,
+			listCommandName,
+			listCommandName,
+			listCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			lister, err := list.NewLister(newKubeConfig(), &list.Config{
+				LabelSelector:      viperConfig.GetString("selector"),
+				SortBy:             viperConfig.GetString("sort-by"),
+				GracePeriod:        viperConfig.GetDuration("grace-period"),
+				NamePrefix:         viperConfig.GetString("name-prefix"),
+				Requestors:         getStringSlice("requestor"),
+				KeepLast:           viperConfig.GetInt("keep-last"),
+				KeepLastGroupLabel: viperConfig.GetString("keep-last-group-label"),
+				ListPageSize:       viperConfig.GetInt64("list-page-size"),
+			})
+			if err != nil {
+				exitCode = 1
+				return
+			}
+			entries, err := lister.List()
+			if err != nil {
+				exitCode = 2
+				return
+			}
+			err = list.WriteReport(os.Stdout, entries, viperConfig.GetString("output"))
+			if err != nil {
+				glog.Errorf("Cannot write the report: %v", err)
+				exitCode = 1
+			}
+		},
+	}
+	rootCommand.AddCommand(listCommand)
+
+	listCommand.PersistentFlags().StringP("selector", "l", viperConfig.GetString("selector"), "only list the Kubernetes csr matching this label selector")
+
+	listCommand.PersistentFlags().Duration("grace-period", viperConfig.GetDuration("grace-period"), "grace period of the gc to report the eligibility of the Kubernetes csr")
+	listCommand.PersistentFlags().String("name-prefix", viperConfig.GetString("name-prefix"), "name prefix of the gc, the Kubernetes csr without it are not eligible")
+	listCommand.PersistentFlags().StringSlice("requestor", viperConfig.GetStringSlice("requestor"), "requestors of the gc, the Kubernetes csr requested by others are not eligible")
+	listCommand.PersistentFlags().Int("keep-last", viperConfig.GetInt("keep-last"), "keep-last of the gc to report the Kubernetes csr beyond the history as eligible")
+	listCommand.PersistentFlags().String("keep-last-group-label", viperConfig.GetString("keep-last-group-label"), "group the Kubernetes csr of --keep-last by the value of this label instead of the common name")
+	listCommand.PersistentFlags().Int64("list-page-size", viperConfig.GetInt64("list-page-size"), "number of Kubernetes csr listed per request, 0 lists all the csr at once")
+
+	viperConfig.SetDefault("sort-by", list.SortByName)
+	listCommand.PersistentFlags().String("sort-by", viperConfig.GetString("sort-by"), fmt.Sprintf("sort the Kubernetes csr by %s, %s, %s or %s", list.SortByName, list.SortByAge, list.SortByExpiry, list.SortByCommonName))
+	viperConfig.BindPFlag("sort-by", listCommand.PersistentFlags().Lookup("sort-by"))
+
+	listCommand.PersistentFlags().StringP("output", "o", list.ReportFormatTable, fmt.Sprintf("format of the list: %s, %s, %s or %s", list.ReportFormatTable, list.ReportFormatWide, list.ReportFormatJSON, list.ReportFormatYAML))
+
+	// verify command
+	verifyCommandName := fmt.Sprintf("%s verify", programName)
+	verifyCommand := &cobra.Command{
+		Use:        "verify",
+		Args:       cobra.ExactArgs(0),
+		SuggestFor: []string{"check", "validate"},
+		Short:      "Verify the private key, the csr and the certificate files match each other with permissions not looser than the configured ones",
+		Example: fmt.Sprintf(`
+# Verify the files generated by kube-csr
+%s
+
+# Verify the files of an app, the private key must not be readable by the group and the others
+%s --private-key-file app.key --csr-file app.csr --certificate-file app.crt --private-key-perm 0600 --certificate-perm 0644
+`,
+			verifyCommandName,
+			verifyCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			bindSharedFlags(cmd)
+			conf, err := newVerifyConfig()
+			if err != nil {
+				exitCode = 2
+				return
+			}
+			err = verify.Verify(conf)
+			if err != nil {
+				exitCode = 1
+			}
+		},
+	}
+	rootCommand.AddCommand(verifyCommand)
+
+	verifyCommand.PersistentFlags().String("private-key-file", viperConfig.GetString("private-key-file"), "private key file to verify, empty to skip")
+	verifyCommand.PersistentFlags().String("csr-file", viperConfig.GetString("csr-file"), "csr file to verify, empty to skip")
+	verifyCommand.PersistentFlags().String("certificate-file", viperConfig.GetString("certificate-file"), "certificate file to verify, empty to skip")
+	verifyCommand.PersistentFlags().Bool("allow-missing-certificate", false, "skip the checks of the certificate file when it doesn't exist yet")
+	viperConfig.BindPFlag("allow-missing-certificate", verifyCommand.PersistentFlags().Lookup("allow-missing-certificate"))
+
+	for _, name := range []string{"private-key-perm", "csr-perm", "certificate-perm"} {
+		verifyCommand.PersistentFlags().String(name, fmt.Sprintf("%04o", viperConfig.GetInt(name)), "loosest permissions allowed for the file in octal, 0 to skip")
+		viperConfig.BindPFlag(name, verifyCommand.PersistentFlags().Lookup(name))
+	}
+
+	// config command
+	configCommand := &cobra.Command{
+		Use:   "config",
+		Args:  cobra.ExactArgs(0),
+		Short: "Manage the configuration of the flags",
+	}
+	rootCommand.AddCommand(configCommand)
+
+	configDumpCommandName := fmt.Sprintf("%s config dump", programName)
+	configDumpCommand := &cobra.Command{
+		Use:        "dump",
+		Args:       cobra.ExactArgs(0),
+		SuggestFor: []string{"print", "show", "view"},
+		Short:      fmt.Sprintf("Print the effective configuration of the flags, merged from the defaults, the config file and the %s_* environment variables", envPrefix),
+		Example: fmt.Sprintf(`
+# Print the configuration merged with the config file
+%s --config kube-csr.yaml
+
+# Generate a config file from the environment variables
+%s_PRIVATE_KEY_FILE=/etc/certs/etcd.private_key %s > kube-csr.yaml
+`,
+			configDumpCommandName,
+			envPrefix,
+			configDumpCommandName,
+		),
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			err := writeConfig(os.Stdout, output)
+			if err != nil {
+				glog.Errorf("Cannot dump the config: %v", err)
+				exitCode = 1
+			}
+		},
+	}
+	configCommand.AddCommand(configDumpCommand)
+
+	configDumpCommand.Flags().StringP("output", "o", configFormatYAML, fmt.Sprintf("format of the config: %s or %s", configFormatYAML, configFormatJSON))
 	return rootCommand, &exitCode
 }
 
+// sharedFlags are declared by several commands
+var sharedFlags = []string{
+	"disable-prometheus-exporter",
+	"prometheus-exporter-bind",
+	"selector",
+	"output",
+	"grace-period",
+	"name-prefix",
+	"requestor",
+	"keep-last",
+	"keep-last-group-label",
+	"list-page-size",
+	"private-key-file",
+	"csr-file",
+	"certificate-file",
+}
+
+// bindSharedFlags binds the shared flags to the ones of the running command
+func bindSharedFlags(cmd *cobra.Command) {
+	for _, name := range sharedFlags {
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			continue
+		}
+		viperConfig.BindPFlag(name, f)
+	}
+}
+
+// newSignalContext returns a context cancelled on the first SIGINT or SIGTERM
+func newSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case s := <-ch:
+			glog.V(0).Infof("Signal %s received, exiting ...", s.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// forceRenewOnSignal forces a renew on each SIGUSR1 until the context is done
+func forceRenewOnSignal(ctx context.Context, re *renew.Renew) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case s := <-ch:
+			glog.V(0).Infof("Signal %s received, forcing the renew ...", s.String())
+			err := re.ForceRenew(ctx)
+			if err != nil {
+				glog.Errorf("Cannot force the renew: %v", err)
+				continue
+			}
+			glog.V(0).Infof("Successfully forced the renew")
+		}
+	}
+}
+
+// newKubeConfig returns the config of the Kubernetes clients
+func newKubeConfig() *kubeclient.Config {
+	return &kubeclient.Config{
+		KubeConfigPath:    viperConfig.GetString("kubeconfig-path"),
+		KubeConfigEnv:     viperConfig.GetBool("kubeconfig-env"),
+		Context:           viperConfig.GetString("context"),
+		Impersonate:       viperConfig.GetString("as"),
+		ImpersonateGroups: getStringSlice("as-group"),
+		QPS:               float32(viperConfig.GetFloat64("kube-api-qps")),
+		Burst:             viperConfig.GetInt("kube-api-burst"),
+		Timeout:           viperConfig.GetDuration("kube-api-timeout"),
+	}
+}
+
 func generateCertificateSigningRequestName(commonName string) (string, error) {
 	csrName := viperConfig.GetString("csr-name")
 	if csrName != "" {
@@ -451,7 +1184,7 @@ func newCSRConfig(commonName, csrName string) (*generate.Config, error) {
 		Name:       csrName,
 		Override:   viperConfig.GetBool("override"),
 		CommonName: commonName,
-		Hosts:      viperConfig.GetStringSlice("subject-alternative-names"),
+		Hosts:      getStringSlice("subject-alternative-names"),
 		RSABits:    viperConfig.GetInt("rsa-bits"),
 
 		LoadPrivateKey:       viperConfig.GetBool("load-private-key"),
@@ -464,8 +1197,8 @@ func newCSRConfig(commonName, csrName string) (*generate.Config, error) {
 }
 
 func newSubmitClient() (*submit.Submit, error) {
-	s, err := submit.NewSubmitter(
-		viperConfig.GetString("kubeconfig-path"),
+	s, err := submit.NewSubmitterFromConfig(
+		newKubeConfig(),
 		&submit.Config{
 			Override: viperConfig.GetBool("override"),
 		},
@@ -477,13 +1210,37 @@ func newSubmitClient() (*submit.Submit, error) {
 }
 
 func newApproveClient() (*approve.Approval, error) {
-	s, err := approve.NewApproval(viperConfig.GetString("kubeconfig-path"))
+	s, err := approve.NewApprovalFromConfig(newKubeConfig())
 	if err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// newVerifyConfig returns the verify config of the files, the relative paths are joined to the working directory
+func newVerifyConfig() (*verify.Config, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		glog.Errorf("Unexpected error: %v", err)
+		return nil, err
+	}
+	abs := func(p string) string {
+		if p == "" || path.IsAbs(p) {
+			return p
+		}
+		return path.Join(wd, p)
+	}
+	return &verify.Config{
+		PrivateKeyABSPath:       abs(viperConfig.GetString("private-key-file")),
+		CSRABSPath:              abs(viperConfig.GetString("csr-file")),
+		CertificateABSPath:      abs(viperConfig.GetString("certificate-file")),
+		PrivateKeyPermission:    os.FileMode(viperConfig.GetInt("private-key-perm")),
+		CSRPermission:           os.FileMode(viperConfig.GetInt("csr-perm")),
+		CertificatePermission:   os.FileMode(viperConfig.GetInt("certificate-perm")),
+		AllowMissingCertificate: viperConfig.GetBool("allow-missing-certificate"),
+	}, nil
+}
+
 func newFetchClient() (*fetch.Fetch, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -510,7 +1267,7 @@ func newFetchClient() (*fetch.Fetch, error) {
 		CertificateABSPath:    crtPath,
 		Annotate:              annotate,
 	}
-	f, err := fetch.NewFetcher(viperConfig.GetString("kubeconfig-path"), conf)
+	f, err := fetch.NewFetcherFromConfig(newKubeConfig(), conf)
 	if err != nil {
 		return nil, err
 	}
@@ -518,7 +1275,7 @@ func newFetchClient() (*fetch.Fetch, error) {
 }
 
 func newDeleteClient() (*purge.Purge, error) {
-	s, err := purge.NewPurge(viperConfig.GetString("kubeconfig-path"), nil)
+	s, err := purge.NewPurgeFromConfig(newKubeConfig(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -526,29 +1283,87 @@ func newDeleteClient() (*purge.Purge, error) {
 }
 
 func newGarbageCollector() (*purge.Purge, error) {
-	conf := purge.NewPurgeConfig(viperConfig.GetDuration("grace-period"))
+	conf := purge.NewPurgeConfigWithPredicates(viperConfig.GetDuration("grace-period"))
 	if viperConfig.GetBool("denied") {
-		conf.ShouldGC = append(conf.ShouldGC, purge.IsConditionDenied)
+		conf.Predicates = append(conf.Predicates, purge.ConditionDenied)
 	}
 	if viperConfig.GetBool("fetched") {
-		conf.ShouldGC = append(conf.ShouldGC, purge.IsAnnotationFetched)
+		conf.Predicates = append(conf.Predicates, purge.AnnotationFetched)
 	}
 	if viperConfig.GetBool("expired") {
-		conf.ShouldGC = append(conf.ShouldGC, purge.IsCertificateExpired)
+		conf.Predicates = append(conf.Predicates, purge.CertificateExpired)
+	}
+	if viperConfig.GetBool("pending") {
+		conf.Predicates = append(conf.Predicates, purge.Pending)
+	}
+	if viperConfig.GetBool("stuck-approved") {
+		conf.Predicates = append(conf.Predicates, purge.StuckApproved)
 	}
 	conf.PollingPeriod = viperConfig.GetDuration("polling-period")
+	archiver, err := newArchiver()
+	if err != nil {
+		return nil, err
+	}
+	conf.Archiver = archiver
+	conf.KeepLast = viperConfig.GetInt("keep-last")
+	conf.KeepLastGroupLabel = viperConfig.GetString("keep-last-group-label")
+	conf.LabelSelector = viperConfig.GetString("selector")
+	conf.NamePrefix = viperConfig.GetString("name-prefix")
+	conf.Requestors = getStringSlice("requestor")
+	conf.ListPageSize = viperConfig.GetInt64("list-page-size")
+	conf.MaxDeletesPerRun = viperConfig.GetInt("max-deletes-per-run")
+	conf.DeleteQPS = viperConfig.GetFloat64("delete-qps")
+	if viperConfig.GetBool("daemon") && viperConfig.GetBool("leader-elect") {
+		identity := viperConfig.GetString("leader-elect-identity")
+		if identity == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				glog.Errorf("Cannot get the hostname for the leader election identity: %v", err)
+				return nil, err
+			}
+			identity = hostname
+		}
+		conf.LeaderElection = &leader.Config{
+			Identity:      identity,
+			Namespace:     viperConfig.GetString("leader-elect-namespace"),
+			Name:          viperConfig.GetString("leader-elect-name"),
+			LeaseDuration: viperConfig.GetDuration("leader-elect-lease-duration"),
+		}
+	}
 	if !viperConfig.GetBool("disable-prometheus-exporter") {
 		conf.PrometheusExporterBindAddress = viperConfig.GetString("prometheus-exporter-bind")
 	}
-	p, err := purge.NewPurge(viperConfig.GetString("kubeconfig-path"), conf)
+	p, err := purge.NewPurgeFromConfig(newKubeConfig(), conf)
 	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
+func newArchiver() (purge.Archiver, error) {
+	archiveFile, archiveConfigMap := viperConfig.GetString("archive-file"), viperConfig.GetString("archive-configmap")
+	if archiveFile != "" && archiveConfigMap != "" {
+		err := fmt.Errorf("cannot use --archive-file with --archive-configmap")
+		glog.Errorf("Cannot use the archive: %v", err)
+		return nil, err
+	}
+	if archiveFile != "" {
+		return purge.NewFileArchiver(archiveFile, viperConfig.GetInt64("archive-max-size"), viperConfig.GetInt("archive-max-backups"))
+	}
+	if archiveConfigMap == "" {
+		return nil, nil
+	}
+	parts := strings.Split(archiveConfigMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		err := fmt.Errorf("invalid --archive-configmap %q, must be namespace/name", archiveConfigMap)
+		glog.Errorf("Cannot use the archive: %v", err)
+		return nil, err
+	}
+	return purge.NewConfigMapArchiver(newKubeConfig(), parts[0], parts[1], viperConfig.GetInt64("archive-max-size"), viperConfig.GetInt("archive-max-backups"))
+}
+
 func newQuery(svcToQuery []string) (*query.Query, error) {
-	q, err := query.NewQuery(viperConfig.GetString("kubeconfig-path"), svcToQuery, &query.Config{
+	q, err := query.NewQueryFromConfig(newKubeConfig(), svcToQuery, &query.Config{
 		PollingTimeout:  viperConfig.GetDuration("query-timeout"),
 		PollingInterval: viperConfig.GetDuration("query-interval"),
 	})
@@ -558,17 +1373,72 @@ func newQuery(svcToQuery []string) (*query.Query, error) {
 	return q, nil
 }
 
+func newReloaders() ([]reload.Reloader, error) {
+	var reloaders []reload.Reloader
+	pidFile, processName := viperConfig.GetString("reload-pid-file"), viperConfig.GetString("reload-process-name")
+	if pidFile != "" || processName != "" {
+		sig, err := reload.ParseSignal(viperConfig.GetString("reload-signal"))
+		if err != nil {
+			glog.Errorf("Cannot use the reload signal: %v", err)
+			return nil, err
+		}
+		if pidFile != "" {
+			reloaders = append(reloaders, reload.NewPidFile(pidFile, sig))
+		}
+		if processName != "" {
+			reloaders = append(reloaders, reload.NewProcessName(processName, sig))
+		}
+	}
+	reloadURL := viperConfig.GetString("reload-http-url")
+	if reloadURL != "" {
+		h, err := reload.NewHTTP(reloadURL, viperConfig.GetString("reload-http-method"))
+		if err != nil {
+			return nil, err
+		}
+		reloaders = append(reloaders, h)
+	}
+	return reloaders, nil
+}
+
 func newRenew(operation *operation.Operation) (*renew.Renew, error) {
+	reloaders, err := newReloaders()
+	if err != nil {
+		return nil, err
+	}
 	conf := &renew.Config{
 		Operation:                operation,
 		RenewThreshold:           viperConfig.GetDuration("renew-threshold"),
 		ExitOnRenew:              viperConfig.GetBool("renew-exit"),
 		GenerateNewKubernetesCSR: !viperConfig.GetBool("override"),
-		RenewCommand:             viperConfig.GetString("renew-command"),
+		SupersededCSRPolicy:      viperConfig.GetString("renew-superseded-csr"),
 		RenewCheckInterval:       viperConfig.GetDuration("renew-check-interval"),
+		RenewLifetimeFraction:    viperConfig.GetFloat64("renew-at-lifetime-fraction"),
+		RenewJitter:              viperConfig.GetFloat64("renew-jitter"),
+		RenewRetryDelay:          viperConfig.GetDuration("renew-retry-delay"),
+		RenewRetryMaxDelay:       viperConfig.GetDuration("renew-retry-max-delay"),
+		ExitOnExpired:            viperConfig.GetBool("renew-exit-on-expired"),
+		DisableFileWatch:         viperConfig.GetBool("renew-disable-file-watch"),
+		DisableRevocationWatch:   viperConfig.GetBool("renew-disable-revocation-watch"),
+		DisablePreflight:         viperConfig.GetBool("renew-disable-preflight"),
+		ForceRenewBindAddress:    viperConfig.GetString("renew-force-bind"),
+		ForceRenewMinInterval:    viperConfig.GetDuration("renew-force-min-interval"),
+		Reloaders:                reloaders,
+		ReloadTimeout:            viperConfig.GetDuration("reload-timeout"),
+		PreRenewHook: &renew.Hook{
+			Command: viperConfig.GetString("renew-pre-command"),
+			Policy:  viperConfig.GetString("renew-pre-command-policy"),
+			Timeout: viperConfig.GetDuration("renew-command-timeout"),
+			Retries: viperConfig.GetInt("renew-command-retries"),
+		},
+		PostRenewHook: &renew.Hook{
+			Command: viperConfig.GetString("renew-command"),
+			Policy:  viperConfig.GetString("renew-command-policy"),
+			Timeout: viperConfig.GetDuration("renew-command-timeout"),
+			Retries: viperConfig.GetInt("renew-command-retries"),
+		},
 	}
 	if !viperConfig.GetBool("disable-prometheus-exporter") {
 		conf.PrometheusExporterBindAddress = viperConfig.GetString("prometheus-exporter-bind")
 	}
-	return renew.NewRenewer(viperConfig.GetString("kubeconfig-path"), conf)
+	return renew.NewRenewerFromConfig(newKubeConfig(), conf)
 }
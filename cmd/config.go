@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+)
+
+const (
+	configFormatYAML = "yaml"
+	configFormatJSON = "json"
+)
+
+// loadConfig reads the KUBE_CSR_* environment variables and the --config file,
+// the flags override the environment variables overriding the config file overriding the defaults
+func loadConfig() error {
+	viperConfig.SetEnvPrefix(envPrefix)
+	viperConfig.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viperConfig.AutomaticEnv()
+
+	configFile := viperConfig.GetString("config")
+	if configFile == "" {
+		return nil
+	}
+	known := make(map[string]struct{})
+	for _, key := range append(viperConfig.AllKeys(), sharedFlags...) {
+		known[key] = struct{}{}
+	}
+	viperConfig.SetConfigFile(configFile)
+	err := viperConfig.ReadInConfig()
+	if err != nil {
+		glog.Errorf("Cannot read the config file %s: %v", configFile, err)
+		return err
+	}
+	for _, key := range viperConfig.AllKeys() {
+		_, ok := known[key]
+		if !ok {
+			glog.Warningf("Unknown key %q in the config file %s", key, configFile)
+		}
+	}
+	return nil
+}
+
+// effectiveConfig returns the value of each key, the durations as strings and the permissions in octal
+func effectiveConfig() map[string]interface{} {
+	config := make(map[string]interface{})
+	for _, key := range viperConfig.AllKeys() {
+		if key == "config" {
+			continue
+		}
+		switch value := viperConfig.Get(key); v := value.(type) {
+		case time.Duration:
+			config[key] = v.String()
+		default:
+			if strings.HasSuffix(key, "-perm") {
+				config[key] = fmt.Sprintf("%04o", viperConfig.GetInt(key))
+				continue
+			}
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// writeConfig writes the effective config in one of the configFormat, it can be read back with --config
+func writeConfig(w io.Writer, format string) error {
+	var b []byte
+	var err error
+	switch format {
+	case configFormatYAML:
+		b, err = yaml.Marshal(effectiveConfig())
+	case configFormatJSON:
+		b, err = json.MarshalIndent(effectiveConfig(), "", "  ")
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("invalid config format %q, must be %s or %s", format, configFormatYAML, configFormatJSON)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// getStringSlice returns the values of the key, the ones of the environment variables and the config file can be comma separated
+func getStringSlice(key string) []string {
+	var values []string
+	for _, value := range viperConfig.GetStringSlice(key) {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
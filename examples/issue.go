@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"path"
@@ -76,7 +77,7 @@ func main() {
 		Approve:      approval,
 		Fetch:        fetcher,
 		Purge:        purger,
-	}).Run()
+	}).Run(context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,313 @@
+package audit
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+const (
+	// StatusOK is a certificate valid after the warning window
+	StatusOK = "ok"
+	// StatusWarning is a certificate expiring within the warning window or missing some SANs
+	StatusWarning = "warning"
+	// StatusCritical is an expired or unreadable certificate or a certificate not matching its private key
+	StatusCritical = "critical"
+
+	// SourceFile is a certificate read from a local file
+	SourceFile = "file"
+	// SourceCSR is a certificate issued in a Kubernetes csr
+	SourceCSR = "csr"
+)
+
+// exit codes by status, the audit errors exit with ExitUnknown
+const (
+	ExitOK = iota
+	ExitWarning
+	ExitCritical
+	ExitUnknown
+)
+
+var statusSeverity = map[string]int{
+	StatusOK:       ExitOK,
+	StatusWarning:  ExitWarning,
+	StatusCritical: ExitCritical,
+}
+
+// Config of the Audit
+type Config struct {
+	// CertificateGlobs are the patterns of the local certificate files to audit
+	CertificateGlobs []string
+	// the private key and the csr of a certificate file are the files with the same name
+	// and the PrivateKeySuffix or the CSRSuffix instead of the CertificateSuffix, checked when present
+	CertificateSuffix string
+	PrivateKeySuffix  string
+	CSRSuffix         string
+
+	// Cluster audits the certificates issued in the Kubernetes csr matching the LabelSelector
+	Cluster       bool
+	LabelSelector string
+
+	// WarningWindow is the duration before the expiry of the certificates to report them as warning
+	WarningWindow time.Duration
+	// RequiredSANs are the subject alternative names each certificate must contain, in addition to the requested ones
+	RequiredSANs []string
+}
+
+// Finding is the audit of a certificate
+type Finding struct {
+	Source     string    `json:"source"`
+	Name       string    `json:"name"`
+	CommonName string    `json:"commonName"`
+	NotAfter   time.Time `json:"notAfter"`
+	Status     string    `json:"status"`
+	Problems   []string  `json:"problems,omitempty"`
+}
+
+// Audit state
+type Audit struct {
+	conf       *Config
+	kubeClient *kubeclient.KubeClient
+}
+
+// NewAudit creates a new Audit, the kube client is only created to audit the cluster
+func NewAudit(kubeConfig *kubeclient.Config, conf *Config) (*Audit, error) {
+	if len(conf.CertificateGlobs) == 0 && !conf.Cluster {
+		err := fmt.Errorf("no certificate glob nor cluster to audit")
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	if conf.WarningWindow < 0 {
+		err := fmt.Errorf("invalid value for WarningWindow: %s", conf.WarningWindow)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	a := &Audit{
+		conf: conf,
+	}
+	if !conf.Cluster {
+		return a, nil
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	a.kubeClient = k
+	return a, nil
+}
+
+// Run audits the certificate files then the certificates of the cluster
+func (a *Audit) Run() ([]*Finding, error) {
+	now := time.Now()
+	findings, err := a.auditFiles(now)
+	if err != nil {
+		return nil, err
+	}
+	if !a.conf.Cluster {
+		return findings, nil
+	}
+	csrFindings, err := a.auditCSRs(now)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, csrFindings...), nil
+}
+
+// auditFiles audits each certificate file matching the globs once
+func (a *Audit) auditFiles(now time.Time) ([]*Finding, error) {
+	var files []string
+	seen := make(map[string]struct{})
+	for _, glob := range a.conf.CertificateGlobs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			glog.Errorf("Invalid certificate glob %q: %v", glob, err)
+			return nil, err
+		}
+		if len(matches) == 0 {
+			glog.Warningf("No certificate file matching %q", glob)
+		}
+		for _, match := range matches {
+			_, ok := seen[match]
+			if ok {
+				continue
+			}
+			seen[match] = struct{}{}
+			files = append(files, match)
+		}
+	}
+	sort.Strings(files)
+	var findings []*Finding
+	for _, file := range files {
+		findings = append(findings, a.auditFile(file, now))
+	}
+	glog.V(1).Infof("Audited %d certificate files", len(findings))
+	return findings, nil
+}
+
+// siblingFile returns the file of the certificate with the given suffix, false when it doesn't exist
+func (a *Audit) siblingFile(certPath, suffix string) (string, bool) {
+	if suffix == "" || a.conf.CertificateSuffix == "" || !strings.HasSuffix(certPath, a.conf.CertificateSuffix) {
+		return "", false
+	}
+	sibling := strings.TrimSuffix(certPath, a.conf.CertificateSuffix) + suffix
+	_, err := os.Stat(sibling)
+	return sibling, err == nil
+}
+
+// auditFile audits the certificate file with its private key and its csr when present
+func (a *Audit) auditFile(certPath string, now time.Time) *Finding {
+	f := &Finding{
+		Source: SourceFile,
+		Name:   certPath,
+		Status: StatusOK,
+	}
+	cert, err := pemio.ReadCertificate(certPath)
+	if err != nil {
+		f.addProblem(StatusCritical, "unreadable certificate: %v", err)
+		return f
+	}
+	var requestedSANs []string
+	csrPath, ok := a.siblingFile(certPath, a.conf.CSRSuffix)
+	if ok {
+		b, err := ioutil.ReadFile(csrPath)
+		if err == nil {
+			var req *x509.CertificateRequest
+			req, err = pemio.ParseCertificateRequest(b)
+			if err == nil {
+				requestedSANs = pemio.SubjectAlternativeNames(req.DNSNames, req.IPAddresses)
+			}
+		}
+		if err != nil {
+			f.addProblem(StatusWarning, "unreadable csr %s: %v", csrPath, err)
+		}
+	}
+	a.check(f, cert, !now.Before(cert.NotAfter), requestedSANs, now)
+
+	keyPath, ok := a.siblingFile(certPath, a.conf.PrivateKeySuffix)
+	if !ok {
+		return f
+	}
+	key, err := pemio.ReadPrivateKey(keyPath)
+	if err != nil {
+		f.addProblem(StatusCritical, "unreadable private key: %v", err)
+		return f
+	}
+	match, err := pemio.MatchPublicKey(cert.PublicKey, key.Public())
+	if err != nil {
+		f.addProblem(StatusCritical, "cannot compare with the private key %s: %v", keyPath, err)
+		return f
+	}
+	if !match {
+		f.addProblem(StatusCritical, "certificate doesn't match the private key %s", keyPath)
+	}
+	return f
+}
+
+// auditCSRs audits the certificates issued in the Kubernetes csr
+func (a *Audit) auditCSRs(now time.Time) ([]*Finding, error) {
+	csrList, err := a.kubeClient.GetCertificateClient().CertificateSigningRequests().List(v1.ListOptions{
+		LabelSelector: a.conf.LabelSelector,
+	})
+	if err != nil {
+		glog.Errorf("Cannot list all csr: %v", err)
+		return nil, err
+	}
+	var findings []*Finding
+	for i := range csrList.Items {
+		csr := &csrList.Items[i]
+		if len(csr.Status.Certificate) == 0 {
+			glog.V(2).Infof("Skipping csr/%s without certificate", csr.Name)
+			continue
+		}
+		findings = append(findings, a.auditCSR(csr, now))
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Name < findings[j].Name
+	})
+	glog.V(1).Infof("Audited %d/%d csr with a certificate", len(findings), len(csrList.Items))
+	return findings, nil
+}
+
+// auditCSR audits the certificate issued in the csr with the SANs of the request
+func (a *Audit) auditCSR(csr *certificates.CertificateSigningRequest, now time.Time) *Finding {
+	f := &Finding{
+		Source: SourceCSR,
+		Name:   csr.Name,
+		Status: StatusOK,
+	}
+	cert, err := pemio.ParseCertificate(csr.Status.Certificate)
+	if err != nil {
+		f.addProblem(StatusCritical, "unreadable certificate: %v", err)
+		return f
+	}
+	var requestedSANs []string
+	req, err := pemio.ParseCertificateRequest(csr.Spec.Request)
+	if err != nil {
+		f.addProblem(StatusWarning, "unreadable request: %v", err)
+	} else {
+		requestedSANs = pemio.SubjectAlternativeNames(req.DNSNames, req.IPAddresses)
+	}
+	a.check(f, cert, !now.Before(cert.NotAfter), requestedSANs, now)
+	return f
+}
+
+// check reports the expiry and the missing SANs of the certificate
+func (a *Audit) check(f *Finding, cert *x509.Certificate, expired bool, requestedSANs []string, now time.Time) {
+	f.CommonName = cert.Subject.CommonName
+	f.NotAfter = cert.NotAfter
+	// the validity of the certificates has a second precision
+	timeLeft := cert.NotAfter.Sub(now.Truncate(time.Second))
+	switch {
+	case expired:
+		f.addProblem(StatusCritical, "expired since %s", (-timeLeft).Round(time.Second))
+	case timeLeft <= a.conf.WarningWindow:
+		f.addProblem(StatusWarning, "expires in %s", timeLeft.Round(time.Second))
+	}
+	sans := make(map[string]struct{})
+	for _, san := range pemio.SubjectAlternativeNames(cert.DNSNames, cert.IPAddresses) {
+		sans[san] = struct{}{}
+	}
+	var missing []string
+	for _, san := range append(append([]string{}, requestedSANs...), a.conf.RequiredSANs...) {
+		_, ok := sans[san]
+		if ok {
+			continue
+		}
+		sans[san] = struct{}{}
+		missing = append(missing, san)
+	}
+	if len(missing) > 0 {
+		f.addProblem(StatusWarning, "missing SANs: %s", strings.Join(missing, ","))
+	}
+}
+
+// addProblem records the problem and raises the status of the finding to the given one
+func (f *Finding) addProblem(status, format string, a ...interface{}) {
+	f.Problems = append(f.Problems, fmt.Sprintf(format, a...))
+	if statusSeverity[status] > statusSeverity[f.Status] {
+		f.Status = status
+	}
+}
+
+// ExitCode returns the exit code of the most severe finding
+func ExitCode(findings []*Finding) int {
+	code := ExitOK
+	for _, f := range findings {
+		if statusSeverity[f.Status] > code {
+			code = statusSeverity[f.Status]
+		}
+	}
+	return code
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+func TestAuditFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	now := time.Now()
+	key, otherKey := pemtest.GenerateKeyOrDie(), pemtest.GenerateKeyOrDie()
+	for name, files := range map[string]map[string][]byte{
+		"ok": {
+			".certificate": pemtest.GenerateCertOrDie(key, "app", now.Add(time.Hour*24*10), "app.svc"),
+			".private_key": pemtest.EncodeKey(key),
+			".csr":         pemtest.GenerateRequestOrDie(key, "app", "app.svc"),
+		},
+		"soon": {
+			".certificate": pemtest.GenerateCertOrDie(key, "app", now.Add(time.Hour)),
+		},
+		"expired": {
+			".certificate": pemtest.GenerateCertOrDie(key, "app", now.Add(-time.Hour)),
+		},
+		"mismatch": {
+			".certificate": pemtest.GenerateCertOrDie(key, "app", now.Add(time.Hour*24*10)),
+			".private_key": pemtest.EncodeKey(otherKey),
+		},
+		"san": {
+			".certificate": pemtest.GenerateCertOrDie(key, "app", now.Add(time.Hour*24*10), "app.svc"),
+			".csr":         pemtest.GenerateRequestOrDie(key, "app", "app.svc", "app.svc.cluster.local"),
+		},
+		"corrupted": {
+			".certificate": []byte("corrupted"),
+		},
+	} {
+		for suffix, b := range files {
+			require.NoError(t, ioutil.WriteFile(path.Join(tempDir, name+suffix), b, 0600))
+		}
+	}
+
+	a := &Audit{
+		conf: &Config{
+			CertificateGlobs:  []string{path.Join(tempDir, "*.certificate"), path.Join(tempDir, "ok.*")},
+			CertificateSuffix: ".certificate",
+			PrivateKeySuffix:  ".private_key",
+			CSRSuffix:         ".csr",
+			WarningWindow:     time.Hour * 24 * 7,
+		},
+	}
+	findings, err := a.auditFiles(now)
+	require.NoError(t, err)
+	status := make(map[string]string)
+	for _, f := range findings {
+		status[path.Base(f.Name)] = f.Status
+	}
+	assert.Equal(t, map[string]string{
+		"corrupted.certificate": StatusCritical,
+		"expired.certificate":   StatusCritical,
+		"mismatch.certificate":  StatusCritical,
+		"ok.certificate":        StatusOK,
+		"san.certificate":       StatusWarning,
+		"soon.certificate":      StatusWarning,
+		// matched by the second glob, not a certificate
+		"ok.csr":         StatusCritical,
+		"ok.private_key": StatusCritical,
+	}, status)
+	assert.Equal(t, ExitCritical, ExitCode(findings))
+}
+
+func TestAuditCSR(t *testing.T) {
+	now := time.Now()
+	key := pemtest.GenerateKeyOrDie()
+	a := &Audit{
+		conf: &Config{
+			WarningWindow: time.Hour,
+			RequiredSANs:  []string{"app.svc"},
+		},
+	}
+	f := a.auditCSR(&certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request: pemtest.GenerateRequestOrDie(key, "app", "app.svc"),
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Certificate: pemtest.GenerateCertOrDie(key, "app", now.Add(time.Hour*2), "app.svc"),
+		},
+	}, now)
+	assert.Equal(t, StatusOK, f.Status)
+	assert.Empty(t, f.Problems)
+	assert.Equal(t, "app", f.CommonName)
+
+	f = a.auditCSR(&certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request: pemtest.GenerateRequestOrDie(key, "app"),
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Certificate: pemtest.GenerateCertOrDie(key, "app", now.Add(time.Minute*30)),
+		},
+	}, now)
+	assert.Equal(t, StatusWarning, f.Status)
+	assert.Equal(t, []string{"expires in 30m0s", "missing SANs: app.svc"}, f.Problems)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitWarning, ExitCode([]*Finding{{Status: StatusOK}, {Status: StatusWarning}}))
+	assert.Equal(t, ExitCritical, ExitCode([]*Finding{{Status: StatusCritical}, {Status: StatusWarning}}))
+}
+
+func TestWriteReport(t *testing.T) {
+	findings := []*Finding{
+		{
+			Source:     SourceCSR,
+			Name:       "app",
+			CommonName: "app",
+			NotAfter:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			Status:     StatusCritical,
+			Problems:   []string{"expired since 1h0m0s"},
+		},
+	}
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteReport(out, findings, ReportFormatText))
+	assert.Equal(t, "STATUS    SOURCE  NAME  COMMON NAME  NOT AFTER             PROBLEMS\ncritical  csr     app   app          2018-01-01T00:00:00Z  expired since 1h0m0s\n", out.String())
+
+	out.Reset()
+	require.NoError(t, WriteReport(out, nil, ReportFormatJSON))
+	assert.Equal(t, "[]\n", out.String())
+
+	assert.Error(t, WriteReport(out, findings, "yaml"))
+}
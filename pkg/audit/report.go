@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// ReportFormatText writes the report as an aligned text table
+	ReportFormatText = "text"
+	// ReportFormatJSON writes the report as a JSON array
+	ReportFormatJSON = "json"
+)
+
+// WriteReport writes the findings with the given format
+func WriteReport(w io.Writer, findings []*Finding, format string) error {
+	switch format {
+	case ReportFormatJSON:
+		if findings == nil {
+			findings = []*Finding{}
+		}
+		b, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case ReportFormatText:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tSOURCE\tNAME\tCOMMON NAME\tNOT AFTER\tPROBLEMS")
+		for _, f := range findings {
+			notAfter := "-"
+			if !f.NotAfter.IsZero() {
+				notAfter = f.NotAfter.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Status, f.Source, f.Name, f.CommonName, notAfter, strings.Join(f.Problems, "; "))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("invalid report format %q, must be one of %s, %s", format, ReportFormatText, ReportFormatJSON)
+}
@@ -0,0 +1,336 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/purge"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/api"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// watchRetryDelay is the delay before listing again the csr after a list or a watch error
+const watchRetryDelay = time.Second * 5
+
+// Config of the Exporter
+type Config struct {
+	// LabelSelector scopes the csr exported
+	LabelSelector string
+
+	// ResyncPeriod lists again all the csr to refresh the cache
+	ResyncPeriod time.Duration
+
+	// RefreshPeriod updates the seconds to expiry of the certificates between the events
+	RefreshPeriod time.Duration
+
+	PrometheusExporterBindAddress string
+}
+
+// csrState is the part of a csr exported, the certificate is parsed once per event
+type csrState struct {
+	state string
+	// expiryLabels are the labels of the expiry gauge, nil without a valid certificate
+	expiryLabels []string
+	notAfter     time.Time
+}
+
+// Exporter keeps the state of the csr updated by a list and watch
+// and exposes the expiry of their certificates and their states
+// Each event only updates the series of its csr
+type Exporter struct {
+	conf       *Config
+	kubeClient *kubeclient.KubeClient
+
+	mu       sync.RWMutex
+	csrs     map[string]*csrState
+	states   map[string]int
+	lastSync time.Time
+	syncErr  error
+
+	promCertificateExpiry *prometheus.GaugeVec
+	promCSRState          *prometheus.GaugeVec
+	promSyncErrors        prometheus.Counter
+}
+
+// RegisterPrometheusMetrics is a convenient function to create and register prometheus metrics
+func RegisterPrometheusMetrics(e *Exporter) error {
+	e.promCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubernetes_csr_certificate_expiry_seconds",
+		Help: "Seconds before the expiry of the certificate issued in each Kubernetes Certificate Signing Request, negative once expired",
+	}, []string{"common_name", "csr", "signer", "requester"})
+	e.promCSRState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubernetes_csr_exporter_state",
+		Help: "Number of Kubernetes Certificate Signing Requests watched by the exporter, by state: pending, approved without certificate, issued and denied",
+	}, []string{"state"})
+	e.promSyncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubernetes_csr_exporter_sync_errors",
+		Help: "Total number of list and watch errors of the Kubernetes Certificate Signing Requests",
+	})
+	for _, state := range []string{purge.StatePending, purge.StateApproved, purge.StateIssued, purge.StateDenied} {
+		e.promCSRState.WithLabelValues(state)
+	}
+	err := prometheus.Register(e.promCertificateExpiry)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(e.promCSRState)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(e.promSyncErrors)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// NewExporter creates a new Exporter
+func NewExporter(kubeConfig *kubeclient.Config, conf *Config) (*Exporter, error) {
+	if conf.ResyncPeriod <= 0 || conf.RefreshPeriod <= 0 {
+		err := fmt.Errorf("invalid value for ResyncPeriod: %s or RefreshPeriod: %s", conf.ResyncPeriod, conf.RefreshPeriod)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		conf:       conf,
+		kubeClient: k,
+		csrs:       make(map[string]*csrState),
+		states:     make(map[string]int),
+	}
+	err = RegisterPrometheusMetrics(e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Run lists and watches the csr to update the metrics, returns when the context is done
+func (e *Exporter) Run(ctx context.Context) error {
+	api.RegisterAPI(e.conf.PrometheusExporterBindAddress, api.PprofBindDefault, &api.Probes{
+		Readyz: e.Readyz,
+	})
+	refresh := time.NewTicker(e.conf.RefreshPeriod)
+	defer refresh.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refresh.C:
+				e.refresh(time.Now())
+			}
+		}
+	}()
+
+	glog.V(0).Infof("Starting the csr exporter, resync every %s", e.conf.ResyncPeriod)
+	for {
+		err := e.listAndWatch(ctx)
+		if ctx.Err() != nil {
+			glog.V(0).Infof("Exiting the csr exporter: %v", ctx.Err())
+			return nil
+		}
+		if err == nil {
+			continue
+		}
+		e.promSyncErrors.Inc()
+		glog.Errorf("Cannot sync the csr, retrying in %s: %v", watchRetryDelay, err)
+		select {
+		case <-ctx.Done():
+			glog.V(0).Infof("Exiting the csr exporter: %v", ctx.Err())
+			return nil
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
+
+// listAndWatch replaces the cache with a list then applies the watch events until the resync period
+func (e *Exporter) listAndWatch(ctx context.Context) error {
+	csrList, err := e.kubeClient.GetCertificateClient().CertificateSigningRequests().List(v1.ListOptions{
+		LabelSelector: e.conf.LabelSelector,
+	})
+	e.setSyncResult(err)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Kube-apiserver returns %d csr", len(csrList.Items))
+	e.replace(csrList.Items, time.Now())
+
+	w, err := e.kubeClient.GetCertificateClient().CertificateSigningRequests().Watch(v1.ListOptions{
+		LabelSelector:   e.conf.LabelSelector,
+		ResourceVersion: csrList.ResourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+	resync := time.NewTimer(e.conf.ResyncPeriod)
+	defer resync.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-resync.C:
+			glog.V(1).Infof("Resync the csr")
+			return nil
+
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				glog.V(1).Infof("Watch of the csr ended, listing again")
+				return nil
+			}
+			if event.Type == watch.Error {
+				return errors.FromObject(event.Object)
+			}
+			csr, ok := event.Object.(*certificates.CertificateSigningRequest)
+			if !ok {
+				return fmt.Errorf("unexpected object type %T", event.Object)
+			}
+			glog.V(4).Infof("Got %s event for csr/%s", event.Type, csr.Name)
+			e.apply(event.Type, csr, time.Now())
+		}
+	}
+}
+
+// newCSRState returns the state of the csr, with the expiry of its certificate if any
+func newCSRState(csr *certificates.CertificateSigningRequest) *csrState {
+	st := &csrState{state: purge.CSRState(csr)}
+	if len(csr.Status.Certificate) == 0 {
+		return st
+	}
+	cert, err := pemio.ParseCertificate(csr.Status.Certificate)
+	if err != nil {
+		glog.V(2).Infof("Cannot parse the certificate of csr/%s: %v", csr.Name, err)
+		return st
+	}
+	st.expiryLabels = []string{cert.Subject.CommonName, csr.Name, cert.Issuer.CommonName, csr.Spec.Username}
+	st.notAfter = cert.NotAfter
+	return st
+}
+
+// equalLabels returns if the label values are the same
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// set updates the series of the csr, the lock must be held
+func (e *Exporter) set(name string, st *csrState, now time.Time) {
+	previous, ok := e.csrs[name]
+	if ok {
+		e.states[previous.state]--
+		e.promCSRState.WithLabelValues(previous.state).Set(float64(e.states[previous.state]))
+		if previous.expiryLabels != nil && !equalLabels(previous.expiryLabels, st.expiryLabels) {
+			e.promCertificateExpiry.DeleteLabelValues(previous.expiryLabels...)
+		}
+	}
+	e.csrs[name] = st
+	e.states[st.state]++
+	e.promCSRState.WithLabelValues(st.state).Set(float64(e.states[st.state]))
+	if st.expiryLabels != nil {
+		e.promCertificateExpiry.WithLabelValues(st.expiryLabels...).Set(st.notAfter.Sub(now).Seconds())
+	}
+}
+
+// remove deletes the series of the csr, the lock must be held
+func (e *Exporter) remove(name string) {
+	previous, ok := e.csrs[name]
+	if !ok {
+		return
+	}
+	delete(e.csrs, name)
+	e.states[previous.state]--
+	e.promCSRState.WithLabelValues(previous.state).Set(float64(e.states[previous.state]))
+	if previous.expiryLabels != nil {
+		e.promCertificateExpiry.DeleteLabelValues(previous.expiryLabels...)
+	}
+}
+
+// replace the states with the listed csr, the series of the csr deleted since the last sync are removed
+func (e *Exporter) replace(csrs []certificates.CertificateSigningRequest, now time.Time) {
+	listed := make(map[string]struct{}, len(csrs))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range csrs {
+		listed[csrs[i].Name] = struct{}{}
+		e.set(csrs[i].Name, newCSRState(&csrs[i]), now)
+	}
+	for name := range e.csrs {
+		_, ok := listed[name]
+		if !ok {
+			e.remove(name)
+		}
+	}
+}
+
+// apply a watch event to the series of its csr
+func (e *Exporter) apply(eventType watch.EventType, csr *certificates.CertificateSigningRequest, now time.Time) {
+	st := newCSRState(csr)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch eventType {
+	case watch.Added, watch.Modified:
+		e.set(csr.Name, st, now)
+	case watch.Deleted:
+		e.remove(csr.Name)
+	}
+}
+
+// refresh updates the seconds to expiry of the certificates
+func (e *Exporter) refresh(now time.Time) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, st := range e.csrs {
+		if st.expiryLabels != nil {
+			e.promCertificateExpiry.WithLabelValues(st.expiryLabels...).Set(st.notAfter.Sub(now).Seconds())
+		}
+	}
+}
+
+// setSyncResult records the result of the last list for the readiness probe
+func (e *Exporter) setSyncResult(err error) {
+	e.mu.Lock()
+	e.lastSync, e.syncErr = time.Now(), err
+	e.mu.Unlock()
+}
+
+// Readyz fails until the last list of csr succeeded
+func (e *Exporter) Readyz() (map[string]string, error) {
+	e.mu.RLock()
+	lastSync, syncErr, nb := e.lastSync, e.syncErr, len(e.csrs)
+	e.mu.RUnlock()
+
+	if lastSync.IsZero() {
+		return nil, fmt.Errorf("waiting for the first list of csr")
+	}
+	details := map[string]string{
+		"lastList": lastSync.Format(time.RFC3339),
+		"csr":      strconv.Itoa(nb),
+	}
+	if syncErr != nil {
+		return details, fmt.Errorf("last list of csr failed: %v", syncErr)
+	}
+	return details, nil
+}
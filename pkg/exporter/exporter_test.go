@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+// gather returns the value of each gauge by its first label value
+func gather(t *testing.T, collector prometheus.Collector) map[string]float64 {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			values[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestUpdateMetrics(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	e := &Exporter{
+		csrs:   make(map[string]*csrState),
+		states: make(map[string]int),
+		promCertificateExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "expiry", Help: "expiry"},
+			[]string{"common_name", "csr", "signer", "requester"}),
+		promCSRState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "state", Help: "state"}, []string{"state"}),
+	}
+	e.replace([]certificates.CertificateSigningRequest{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app"},
+			Spec:       certificates.CertificateSigningRequestSpec{Username: "system:node:a"},
+			Status: certificates.CertificateSigningRequestStatus{
+				Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "app", now.Add(time.Hour)),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+		},
+	}, now)
+	e.apply(watch.Added, &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "db"},
+		Status: certificates.CertificateSigningRequestStatus{
+			Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "db", now.Add(-time.Minute)),
+		},
+	}, now)
+	assert.Equal(t, map[string]float64{
+		"app": time.Hour.Seconds(),
+		"db":  -time.Minute.Seconds(),
+	}, gather(t, e.promCertificateExpiry))
+	assert.Equal(t, map[string]float64{
+		"pending": 1,
+		"issued":  2,
+	}, gather(t, e.promCSRState))
+
+	e.apply(watch.Deleted, &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+	}, now)
+	assert.Equal(t, map[string]float64{
+		"db": -time.Minute.Seconds(),
+	}, gather(t, e.promCertificateExpiry))
+
+	// the pending csr is issued with a certificate for another common name
+	e.apply(watch.Modified, &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+		Status: certificates.CertificateSigningRequestStatus{
+			Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "web", now.Add(time.Minute)),
+		},
+	}, now)
+	e.refresh(now.Add(time.Minute))
+	assert.Equal(t, map[string]float64{
+		"db":  -(time.Minute * 2).Seconds(),
+		"web": 0,
+	}, gather(t, e.promCertificateExpiry))
+	assert.Equal(t, map[string]float64{
+		"pending": 0,
+		"issued":  2,
+	}, gather(t, e.promCSRState))
+
+	// the csr deleted during a watch error are removed by the next list
+	e.replace(nil, now)
+	assert.Empty(t, gather(t, e.promCertificateExpiry))
+	assert.Equal(t, map[string]float64{
+		"pending": 0,
+		"issued":  0,
+	}, gather(t, e.promCSRState))
+}
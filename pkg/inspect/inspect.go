@@ -0,0 +1,301 @@
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// CSRPrefix is the prefix of the arguments naming a Kubernetes csr instead of a file
+const CSRPrefix = "csr/"
+
+// Key is the type and the size in bits of a decoded key
+type Key struct {
+	Type string `json:"type"`
+	Size int    `json:"size"`
+}
+
+// Request is a decoded certificate request
+type Request struct {
+	Subject            string   `json:"subject"`
+	SANs               []string `json:"sans,omitempty"`
+	SignatureAlgorithm string   `json:"signatureAlgorithm"`
+	PublicKey          *Key     `json:"publicKey"`
+}
+
+// Certificate is a decoded certificate
+type Certificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	Serial             string    `json:"serial"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	KeyUsages          []string  `json:"keyUsages,omitempty"`
+	ExtKeyUsages       []string  `json:"extKeyUsages,omitempty"`
+	SANs               []string  `json:"sans,omitempty"`
+	IsCA               bool      `json:"isCA"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	PublicKey          *Key      `json:"publicKey"`
+	FingerprintSHA256  string    `json:"fingerprintSHA256"`
+}
+
+// Condition of a Kubernetes csr
+type Condition struct {
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason,omitempty"`
+	Message        string    `json:"message,omitempty"`
+	LastUpdateTime time.Time `json:"lastUpdateTime"`
+}
+
+// CSR is the metadata and the status of a Kubernetes csr
+type CSR struct {
+	Requester   string            `json:"requester"`
+	Groups      []string          `json:"groups,omitempty"`
+	Created     time.Time         `json:"created"`
+	Conditions  []Condition       `json:"conditions,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Inspection is the decoded content of a pem file or a Kubernetes csr
+type Inspection struct {
+	Name         string         `json:"name"`
+	CSR          *CSR           `json:"csr,omitempty"`
+	PrivateKeys  []*Key         `json:"privateKeys,omitempty"`
+	Requests     []*Request     `json:"requests,omitempty"`
+	Certificates []*Certificate `json:"certificates,omitempty"`
+}
+
+// Inspector decodes the pem files and the Kubernetes csr
+type Inspector struct {
+	kubeConfig *kubeclient.Config
+	kubeClient *kubeclient.KubeClient
+}
+
+// NewInspector creates a new Inspector, the kube client is created on the first csr to inspect
+func NewInspector(kubeConfig *kubeclient.Config) *Inspector {
+	return &Inspector{
+		kubeConfig: kubeConfig,
+	}
+}
+
+// Inspect decodes the file or the Kubernetes csr named with the CSRPrefix
+func (i *Inspector) Inspect(arg string) (*Inspection, error) {
+	in, err := i.inspect(arg)
+	if err != nil {
+		glog.Errorf("Cannot inspect %s: %v", arg, err)
+		return nil, err
+	}
+	return in, nil
+}
+
+func (i *Inspector) inspect(arg string) (*Inspection, error) {
+	if !strings.HasPrefix(arg, CSRPrefix) {
+		b, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return InspectPEM(arg, b)
+	}
+	if i.kubeClient == nil {
+		k, err := kubeclient.NewKubeClientFromConfig(i.kubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		i.kubeClient = k
+	}
+	csr, err := i.kubeClient.GetCertificateClient().CertificateSigningRequests().Get(strings.TrimPrefix(arg, CSRPrefix), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return InspectCSR(csr)
+}
+
+// InspectPEM decodes each pem block, the blocks of an unknown type are skipped
+func InspectPEM(name string, b []byte) (*Inspection, error) {
+	in := &Inspection{
+		Name: name,
+	}
+	decoded := 0
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse certificate in %s: %v", name, err)
+			}
+			in.Certificates = append(in.Certificates, newCertificate(cert))
+
+		case strings.HasSuffix(block.Type, "CERTIFICATE REQUEST"):
+			req, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse certificate request in %s: %v", name, err)
+			}
+			in.Requests = append(in.Requests, NewRequest(req))
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			key, err := pemio.ParsePrivateKey(pem.EncodeToMemory(block))
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse private key in %s: %v", name, err)
+			}
+			in.PrivateKeys = append(in.PrivateKeys, newKey(key.Public()))
+
+		default:
+			glog.Warningf("Skipping the pem block %q of %s", block.Type, name)
+			continue
+		}
+		decoded++
+	}
+	if decoded == 0 {
+		return nil, fmt.Errorf("no private key, certificate request or certificate in %s", name)
+	}
+	return in, nil
+}
+
+// InspectCSR decodes the request and the certificate of the csr with its conditions and its kube-csr annotations
+func InspectCSR(csr *certificates.CertificateSigningRequest) (*Inspection, error) {
+	in := &Inspection{
+		Name: CSRPrefix + csr.Name,
+		CSR: &CSR{
+			Requester:   csr.Spec.Username,
+			Groups:      csr.Spec.Groups,
+			Created:     csr.CreationTimestamp.Time,
+			Annotations: make(map[string]string),
+		},
+	}
+	for _, c := range csr.Status.Conditions {
+		in.CSR.Conditions = append(in.CSR.Conditions, Condition{
+			Type:           string(c.Type),
+			Reason:         c.Reason,
+			Message:        c.Message,
+			LastUpdateTime: c.LastUpdateTime.Time,
+		})
+	}
+	for k, v := range csr.Annotations {
+		if strings.HasPrefix(k, fetch.KubeCSRFetchedAnnotationPrefix) {
+			in.CSR.Annotations[k] = v
+		}
+	}
+	req, err := pemio.ParseCertificateRequest(csr.Spec.Request)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the request of csr/%s: %v", csr.Name, err)
+	}
+	in.Requests = append(in.Requests, NewRequest(req))
+	if len(csr.Status.Certificate) == 0 {
+		return in, nil
+	}
+	cert, err := pemio.ParseCertificate(csr.Status.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the certificate of csr/%s: %v", csr.Name, err)
+	}
+	in.Certificates = append(in.Certificates, newCertificate(cert))
+	return in, nil
+}
+
+// newKey returns the type and the size in bits of the public key
+func newKey(key crypto.PublicKey) *Key {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &Key{Type: "RSA", Size: k.N.BitLen()}
+	case *ecdsa.PublicKey:
+		return &Key{Type: "ECDSA", Size: k.Curve.Params().BitSize}
+	}
+	return &Key{Type: fmt.Sprintf("%T", key)}
+}
+
+// NewRequest decodes the subject, the SANs, the signature algorithm and the public key of the request
+func NewRequest(req *x509.CertificateRequest) *Request {
+	return &Request{
+		Subject:            req.Subject.String(),
+		SANs:               pemio.SubjectAlternativeNames(req.DNSNames, req.IPAddresses),
+		SignatureAlgorithm: req.SignatureAlgorithm.String(),
+		PublicKey:          newKey(req.PublicKey),
+	}
+}
+
+func newCertificate(cert *x509.Certificate) *Certificate {
+	sum := sha256.Sum256(cert.Raw)
+	fingerprint := make([]string, len(sum))
+	for i, b := range sum {
+		fingerprint[i] = fmt.Sprintf("%02X", b)
+	}
+	return &Certificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             cert.SerialNumber.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		KeyUsages:          keyUsages(cert.KeyUsage),
+		ExtKeyUsages:       extKeyUsages(cert.ExtKeyUsage),
+		SANs:               pemio.SubjectAlternativeNames(cert.DNSNames, cert.IPAddresses),
+		IsCA:               cert.IsCA,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		PublicKey:          newKey(cert.PublicKey),
+		FingerprintSHA256:  strings.Join(fingerprint, ":"),
+	}
+}
+
+var keyUsageNames = map[x509.KeyUsage]string{
+	x509.KeyUsageDigitalSignature:  "digital signature",
+	x509.KeyUsageContentCommitment: "content commitment",
+	x509.KeyUsageKeyEncipherment:   "key encipherment",
+	x509.KeyUsageDataEncipherment:  "data encipherment",
+	x509.KeyUsageKeyAgreement:      "key agreement",
+	x509.KeyUsageCertSign:          "cert sign",
+	x509.KeyUsageCRLSign:           "crl sign",
+	x509.KeyUsageEncipherOnly:      "encipher only",
+	x509.KeyUsageDecipherOnly:      "decipher only",
+}
+
+func keyUsages(usage x509.KeyUsage) []string {
+	var usages []string
+	for bit, name := range keyUsageNames {
+		if usage&bit != 0 {
+			usages = append(usages, name)
+		}
+	}
+	sort.Strings(usages)
+	return usages
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "server auth",
+	x509.ExtKeyUsageClientAuth:      "client auth",
+	x509.ExtKeyUsageCodeSigning:     "code signing",
+	x509.ExtKeyUsageEmailProtection: "email protection",
+	x509.ExtKeyUsageTimeStamping:    "time stamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocsp signing",
+}
+
+func extKeyUsages(usages []x509.ExtKeyUsage) []string {
+	var names []string
+	for _, usage := range usages {
+		name, ok := extKeyUsageNames[usage]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", usage)
+		}
+		names = append(names, name)
+	}
+	return names
+}
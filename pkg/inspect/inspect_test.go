@@ -0,0 +1,126 @@
+package inspect
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+var notBefore = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func generateOrDie() (key, req, cert []byte) {
+	privateKey := pemtest.GenerateKeyOrDie()
+	req = pemtest.GenerateRequestFromTemplateOrDie(privateKey, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "app"},
+		DNSNames:    []string{"app.svc"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	})
+	cert = pemtest.GenerateCertFromTemplateOrDie(privateKey, &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "app"},
+		Issuer:       pkix.Name{CommonName: "ca"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"app.svc"},
+	})
+	return pemtest.EncodeKey(privateKey), req, cert
+}
+
+func TestInspectPEM(t *testing.T) {
+	key, req, cert := generateOrDie()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	bundle := bytes.Join([][]byte{
+		key,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "UNKNOWN", Bytes: []byte("unknown")}),
+		req,
+		cert,
+	}, nil)
+	in, err := InspectPEM("bundle", bundle)
+	require.NoError(t, err)
+	assert.Equal(t, []*Key{{Type: "RSA", Size: 1024}, {Type: "ECDSA", Size: 256}}, in.PrivateKeys)
+
+	require.Len(t, in.Requests, 1)
+	assert.Equal(t, "CN=app", in.Requests[0].Subject)
+	assert.Equal(t, []string{"app.svc", "10.0.0.1"}, in.Requests[0].SANs)
+	assert.Equal(t, "SHA256-RSA", in.Requests[0].SignatureAlgorithm)
+
+	require.Len(t, in.Certificates, 1)
+	c := in.Certificates[0]
+	assert.Equal(t, "CN=ca", c.Issuer)
+	assert.Equal(t, "42", c.Serial)
+	assert.Equal(t, notBefore.Add(time.Hour), c.NotAfter.UTC())
+	assert.Equal(t, []string{"digital signature", "key encipherment"}, c.KeyUsages)
+	assert.Equal(t, []string{"server auth"}, c.ExtKeyUsages)
+	assert.Equal(t, []string{"app.svc"}, c.SANs)
+	assert.Len(t, c.FingerprintSHA256, 32*3-1)
+
+	_, err = InspectPEM("corrupted", []byte("corrupted"))
+	assert.Error(t, err)
+}
+
+func TestInspectCSR(t *testing.T) {
+	_, req, cert := generateOrDie()
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app",
+			CreationTimestamp: metav1.NewTime(notBefore),
+			Annotations: map[string]string{
+				fetch.KubeCsrFetchedAnnotationNb: "2",
+				"other":                          "ignored",
+			},
+		},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request:  req,
+			Username: "system:node:a",
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Conditions: []certificates.CertificateSigningRequestCondition{
+				{
+					Type:           certificates.CertificateApproved,
+					Reason:         "AutoApproved",
+					LastUpdateTime: metav1.NewTime(notBefore),
+				},
+			},
+		},
+	}
+	in, err := InspectCSR(csr)
+	require.NoError(t, err)
+	assert.Equal(t, "csr/app", in.Name)
+	assert.Equal(t, map[string]string{fetch.KubeCsrFetchedAnnotationNb: "2"}, in.CSR.Annotations)
+	assert.Len(t, in.Requests, 1)
+	assert.Empty(t, in.Certificates)
+
+	csr.Status.Certificate = cert
+	in, err = InspectCSR(csr)
+	require.NoError(t, err)
+	assert.Len(t, in.Certificates, 1)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteReport(out, []*Inspection{in}, ReportFormatText))
+	assert.Contains(t, out.String(), "csr/app:\n  CSR:\n    Requester: system:node:a\n    Created: 2018-01-01T00:00:00Z\n    Condition: Approved at 2018-01-01T00:00:00Z, reason: AutoApproved\n    Annotation: alpha.kube-csr/fetchCount=2\n")
+	assert.Contains(t, out.String(), "    Serial: 42\n")
+	assert.Error(t, WriteReport(out, nil, "yaml"))
+}
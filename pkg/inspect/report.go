@@ -0,0 +1,103 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ReportFormatText writes the inspections as indented text
+	ReportFormatText = "text"
+	// ReportFormatJSON writes the inspections as a JSON array
+	ReportFormatJSON = "json"
+)
+
+// WriteReport writes the inspections with the given format
+func WriteReport(w io.Writer, inspections []*Inspection, format string) error {
+	switch format {
+	case ReportFormatJSON:
+		if inspections == nil {
+			inspections = []*Inspection{}
+		}
+		b, err := json.MarshalIndent(inspections, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case ReportFormatText:
+		for _, in := range inspections {
+			writeText(w, in)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid report format %q, must be one of %s, %s", format, ReportFormatText, ReportFormatJSON)
+}
+
+func writeText(w io.Writer, in *Inspection) {
+	fmt.Fprintf(w, "%s:\n", in.Name)
+	if in.CSR != nil {
+		fmt.Fprintf(w, "  CSR:\n")
+		fmt.Fprintf(w, "    Requester: %s\n", in.CSR.Requester)
+		if len(in.CSR.Groups) > 0 {
+			fmt.Fprintf(w, "    Groups: %s\n", strings.Join(in.CSR.Groups, ", "))
+		}
+		fmt.Fprintf(w, "    Created: %s\n", in.CSR.Created.UTC().Format(time.RFC3339))
+		for _, c := range in.CSR.Conditions {
+			fmt.Fprintf(w, "    Condition: %s at %s", c.Type, c.LastUpdateTime.UTC().Format(time.RFC3339))
+			if c.Reason != "" {
+				fmt.Fprintf(w, ", reason: %s", c.Reason)
+			}
+			if c.Message != "" {
+				fmt.Fprintf(w, ", message: %s", c.Message)
+			}
+			fmt.Fprintln(w)
+		}
+		var keys []string
+		for k := range in.CSR.Annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "    Annotation: %s=%s\n", k, in.CSR.Annotations[k])
+		}
+	}
+	for _, k := range in.PrivateKeys {
+		fmt.Fprintf(w, "  Private Key: %s %d bits\n", k.Type, k.Size)
+	}
+	for _, r := range in.Requests {
+		fmt.Fprintf(w, "  Certificate Request:\n")
+		fmt.Fprintf(w, "    Subject: %s\n", r.Subject)
+		if len(r.SANs) > 0 {
+			fmt.Fprintf(w, "    SANs: %s\n", strings.Join(r.SANs, ", "))
+		}
+		fmt.Fprintf(w, "    Signature Algorithm: %s\n", r.SignatureAlgorithm)
+		fmt.Fprintf(w, "    Public Key: %s %d bits\n", r.PublicKey.Type, r.PublicKey.Size)
+	}
+	for _, c := range in.Certificates {
+		fmt.Fprintf(w, "  Certificate:\n")
+		fmt.Fprintf(w, "    Subject: %s\n", c.Subject)
+		fmt.Fprintf(w, "    Issuer: %s\n", c.Issuer)
+		fmt.Fprintf(w, "    Serial: %s\n", c.Serial)
+		fmt.Fprintf(w, "    Not Before: %s\n", c.NotBefore.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "    Not After: %s\n", c.NotAfter.UTC().Format(time.RFC3339))
+		if len(c.KeyUsages) > 0 {
+			fmt.Fprintf(w, "    Key Usages: %s\n", strings.Join(c.KeyUsages, ", "))
+		}
+		if len(c.ExtKeyUsages) > 0 {
+			fmt.Fprintf(w, "    Extended Key Usages: %s\n", strings.Join(c.ExtKeyUsages, ", "))
+		}
+		if len(c.SANs) > 0 {
+			fmt.Fprintf(w, "    SANs: %s\n", strings.Join(c.SANs, ", "))
+		}
+		fmt.Fprintf(w, "    CA: %t\n", c.IsCA)
+		fmt.Fprintf(w, "    Signature Algorithm: %s\n", c.SignatureAlgorithm)
+		fmt.Fprintf(w, "    Public Key: %s %d bits\n", c.PublicKey.Type, c.PublicKey.Size)
+		fmt.Fprintf(w, "    SHA256 Fingerprint: %s\n", c.FingerprintSHA256)
+	}
+}
@@ -0,0 +1,223 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/inspect"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/purge"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+const (
+	// SortByName sorts the entries by csr name
+	SortByName = "name"
+	// SortByAge sorts the entries from the most recent csr
+	SortByAge = "age"
+	// SortByExpiry sorts the entries from the certificate expiring first, the csr without certificate last
+	SortByExpiry = "expiry"
+	// SortByCommonName sorts the entries by common name then by csr name
+	SortByCommonName = "cn"
+)
+
+// Eligibility is the reason of the gc to delete the csr, a predicate or the keep-last history
+type Eligibility struct {
+	Predicate       string        `json:"predicate"`
+	GracePeriodLeft time.Duration `json:"-"`
+}
+
+// MarshalJSON writes the duration in seconds
+func (e Eligibility) MarshalJSON() ([]byte, error) {
+	type eligibility Eligibility
+	return json.Marshal(&struct {
+		eligibility
+		GracePeriodLeftSeconds float64 `json:"gracePeriodLeftSeconds"`
+	}{
+		eligibility:            eligibility(e),
+		GracePeriodLeftSeconds: e.GracePeriodLeft.Round(time.Second).Seconds(),
+	})
+}
+
+// Entry is the decoded status of a Kubernetes csr
+type Entry struct {
+	Name       string        `json:"name"`
+	Requester  string        `json:"requester"`
+	Created    time.Time     `json:"created"`
+	CommonName string        `json:"commonName"`
+	SANs       []string      `json:"sans,omitempty"`
+	Key        *inspect.Key  `json:"key,omitempty"`
+	Condition  string        `json:"condition"`
+	FetchCount int           `json:"fetchCount"`
+	LastFetch  *time.Time    `json:"lastFetch,omitempty"`
+	NotAfter   *time.Time    `json:"notAfter,omitempty"`
+	GC         []Eligibility `json:"gc,omitempty"`
+}
+
+// Config of the Lister
+type Config struct {
+	LabelSelector string
+	SortBy        string
+
+	// GracePeriod, NamePrefix, Requestors, KeepLast and KeepLastGroupLabel are the ones of the gc
+	// to report the eligibility of the csr with all the predicates
+	GracePeriod        time.Duration
+	NamePrefix         string
+	Requestors         []string
+	KeepLast           int
+	KeepLastGroupLabel string
+
+	// ListPageSize limits the number of csr returned by each list, 0 lists all the csr at once
+	ListPageSize int64
+}
+
+// Lister lists the Kubernetes csr with their decoded status
+type Lister struct {
+	conf       *Config
+	kubeClient *kubeclient.KubeClient
+}
+
+// NewLister creates a new Lister
+func NewLister(kubeConfig *kubeclient.Config, conf *Config) (*Lister, error) {
+	if conf.ListPageSize < 0 {
+		err := fmt.Errorf("invalid value for ListPageSize: %d", conf.ListPageSize)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	switch conf.SortBy {
+	case SortByName, SortByAge, SortByExpiry, SortByCommonName:
+	default:
+		err := fmt.Errorf("invalid sort %q, must be one of %s, %s, %s, %s", conf.SortBy, SortByName, SortByAge, SortByExpiry, SortByCommonName)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Lister{
+		conf:       conf,
+		kubeClient: k,
+	}, nil
+}
+
+// gcConfig returns the config of a gc with all the predicates
+func (l *Lister) gcConfig() *purge.Config {
+	conf := purge.NewPurgeConfigWithPredicates(l.conf.GracePeriod, purge.AllPredicates...)
+	conf.NamePrefix = l.conf.NamePrefix
+	conf.Requestors = l.conf.Requestors
+	conf.KeepLast = l.conf.KeepLast
+	conf.KeepLastGroupLabel = l.conf.KeepLastGroupLabel
+	return conf
+}
+
+// List returns the sorted entries of the csr matching the LabelSelector, listed by pages of ListPageSize
+// the eligibility of the csr is evaluated like the gc does
+func (l *Lister) List() ([]*Entry, error) {
+	var csrs []certificates.CertificateSigningRequest
+	evaluator := purge.NewEvaluator(l.gcConfig(), time.Now())
+	continueToken := ""
+	for {
+		csrList, err := l.kubeClient.GetCertificateClient().CertificateSigningRequests().List(v1.ListOptions{
+			LabelSelector: l.conf.LabelSelector,
+			Limit:         l.conf.ListPageSize,
+			Continue:      continueToken,
+		})
+		if (errors.IsResourceExpired(err) || errors.IsGone(err)) && continueToken != "" {
+			glog.Warningf("Cannot continue the list, restarting from the first page: %v", err)
+			csrs, evaluator, continueToken = nil, purge.NewEvaluator(l.gcConfig(), time.Now()), ""
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Cannot list all csr: %v", err)
+			return nil, err
+		}
+		csrs = append(csrs, csrList.Items...)
+		evaluator.Add(csrList.Items)
+		continueToken = csrList.Continue
+		if continueToken == "" {
+			break
+		}
+	}
+	matches := evaluator.Matches()
+	entries := make([]*Entry, 0, len(csrs))
+	for i := range csrs {
+		entries = append(entries, NewEntry(&csrs[i], matches[csrs[i].Name]))
+	}
+	Sort(entries, l.conf.SortBy)
+	return entries, nil
+}
+
+// NewEntry decodes the request, the certificate and the kube-csr annotations of the csr,
+// the candidates of the gc are the eligibility of the csr per predicate, empty when the gc would keep it
+func NewEntry(csr *certificates.CertificateSigningRequest, candidates []*purge.Candidate) *Entry {
+	e := &Entry{
+		Name:      csr.Name,
+		Requester: csr.Spec.Username,
+		Created:   csr.CreationTimestamp.Time,
+		Condition: purge.CSRState(csr),
+	}
+	req, err := pemio.ParseCertificateRequest(csr.Spec.Request)
+	if err != nil {
+		glog.V(2).Infof("Cannot parse the request of csr/%s: %v", csr.Name, err)
+	} else {
+		r := inspect.NewRequest(req)
+		e.CommonName, e.SANs, e.Key = req.Subject.CommonName, r.SANs, r.PublicKey
+	}
+	if len(csr.Status.Certificate) > 0 {
+		cert, err := pemio.ParseCertificate(csr.Status.Certificate)
+		if err != nil {
+			glog.V(2).Infof("Cannot parse the certificate of csr/%s: %v", csr.Name, err)
+		} else {
+			e.NotAfter = &cert.NotAfter
+		}
+	}
+	e.FetchCount, _ = strconv.Atoi(csr.Annotations[fetch.KubeCsrFetchedAnnotationNb])
+	lastFetch, err := time.Parse(fetch.KubeCsrFetchedAnnotationDateFormat, csr.Annotations[fetch.KubeCsrFetchedAnnotationDate])
+	if err == nil {
+		e.LastFetch = &lastFetch
+	}
+	for _, candidate := range candidates {
+		left := candidate.GracePeriodLeft
+		if left < 0 {
+			left = 0
+		}
+		e.GC = append(e.GC, Eligibility{Predicate: candidate.Predicate, GracePeriodLeft: left})
+	}
+	return e
+}
+
+// Sort the entries with one of the SortBy
+func Sort(entries []*Entry, sortBy string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch sortBy {
+		case SortByAge:
+			if !a.Created.Equal(b.Created) {
+				return a.Created.After(b.Created)
+			}
+		case SortByExpiry:
+			if a.NotAfter == nil || b.NotAfter == nil {
+				if a.NotAfter != b.NotAfter {
+					return b.NotAfter == nil
+				}
+			} else if !a.NotAfter.Equal(*b.NotAfter) {
+				return a.NotAfter.Before(*b.NotAfter)
+			}
+		case SortByCommonName:
+			if a.CommonName != b.CommonName {
+				return a.CommonName < b.CommonName
+			}
+		}
+		return a.Name < b.Name
+	})
+}
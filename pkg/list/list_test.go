@@ -0,0 +1,122 @@
+package list
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/inspect"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/purge"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+var now = time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func generateOrDie(commonName string, notAfter time.Time) (req, cert []byte) {
+	privateKey := pemtest.GenerateKeyOrDie()
+	return pemtest.GenerateRequestOrDie(privateKey, commonName, commonName+".svc"), pemtest.GenerateCertOrDie(privateKey, commonName, notAfter)
+}
+
+func TestNewEntry(t *testing.T) {
+	req, cert := generateOrDie("app", now.Add(time.Hour*24*3))
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "app-1",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour * 24)),
+			Annotations: map[string]string{
+				fetch.KubeCsrFetchedAnnotationNb:   "2",
+				fetch.KubeCsrFetchedAnnotationDate: now.Add(-time.Hour).Format(fetch.KubeCsrFetchedAnnotationDateFormat),
+			},
+		},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request:  req,
+			Username: "admin",
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Conditions: []certificates.CertificateSigningRequestCondition{
+				{Type: certificates.CertificateApproved},
+			},
+			Certificate: cert,
+		},
+	}
+	l := &Lister{conf: &Config{GracePeriod: time.Hour * 2}}
+	evaluator := purge.NewEvaluator(l.gcConfig(), now)
+	evaluator.Add([]certificates.CertificateSigningRequest{*csr})
+	e := NewEntry(csr, evaluator.Matches()[csr.Name])
+	assert.Equal(t, "app", e.CommonName)
+	assert.Equal(t, []string{"app.svc"}, e.SANs)
+	assert.Equal(t, &inspect.Key{Type: "RSA", Size: 1024}, e.Key)
+	assert.Equal(t, "issued", e.Condition)
+	assert.Equal(t, 2, e.FetchCount)
+	require.NotNil(t, e.LastFetch)
+	assert.Equal(t, now.Add(-time.Hour), *e.LastFetch)
+	require.NotNil(t, e.NotAfter)
+	assert.Equal(t, []Eligibility{{Predicate: "fetched", GracePeriodLeft: time.Hour}}, e.GC)
+
+	// retained from the gc
+	retained := csr.DeepCopy()
+	retained.Annotations[purge.KubeCSRRetainAnnotation] = "true"
+	evaluator = purge.NewEvaluator(l.gcConfig(), now)
+	evaluator.Add([]certificates.CertificateSigningRequest{*retained})
+	assert.Empty(t, NewEntry(retained, evaluator.Matches()[csr.Name]).GC)
+
+	// fetched and expired
+	expired := csr.DeepCopy()
+	_, expired.Status.Certificate = generateOrDie("app", now.Add(-time.Hour*3))
+	evaluator = purge.NewEvaluator(l.gcConfig(), now)
+	evaluator.Add([]certificates.CertificateSigningRequest{*expired})
+	assert.Equal(t, []Eligibility{
+		{Predicate: "expired", GracePeriodLeft: 0},
+		{Predicate: "fetched", GracePeriodLeft: time.Hour},
+	}, NewEntry(expired, evaluator.Matches()[csr.Name]).GC)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writeTable(out, []*Entry{e, {Name: "pending", Condition: "pending", Created: now}}, false, now))
+	assert.Equal(t, `NAME     CN      SANS     KEY       CONDITION  FETCHES  LAST FETCH  EXPIRES  GC
+app-1    app     app.svc  RSA-1024  issued     2        1h0m ago    in 3d0h  fetched
+pending  <none>  <none>   <none>    pending    0        <none>      <none>   <none>
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, writeTable(out, []*Entry{e}, true, now))
+	assert.Contains(t, out.String(), "fetched(1h0m)  admin      1d0h\n")
+
+	out.Reset()
+	require.NoError(t, WriteReport(out, []*Entry{{Name: "a", GC: []Eligibility{{Predicate: "denied", GracePeriodLeft: time.Minute}}}}, ReportFormatYAML))
+	assert.Contains(t, out.String(), "- commonName: \"\"\n")
+	assert.Contains(t, out.String(), "  - gracePeriodLeftSeconds: 60\n    predicate: denied\n")
+	assert.Error(t, WriteReport(out, nil, "xml"))
+}
+
+func TestSort(t *testing.T) {
+	notAfter := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	entries := []*Entry{
+		{Name: "c", CommonName: "a", Created: now.Add(-time.Hour)},
+		{Name: "a", CommonName: "b", Created: now.Add(-time.Minute), NotAfter: notAfter(time.Hour)},
+		{Name: "b", CommonName: "a", Created: now, NotAfter: notAfter(time.Minute)},
+	}
+	names := func() []string {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	Sort(entries, SortByName)
+	assert.Equal(t, []string{"a", "b", "c"}, names())
+	Sort(entries, SortByAge)
+	assert.Equal(t, []string{"b", "a", "c"}, names())
+	Sort(entries, SortByExpiry)
+	assert.Equal(t, []string{"b", "a", "c"}, names())
+	Sort(entries, SortByCommonName)
+	assert.Equal(t, []string{"b", "c", "a"}, names())
+}
@@ -0,0 +1,116 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// ReportFormatTable writes the main columns as an aligned table
+	ReportFormatTable = "table"
+	// ReportFormatWide writes all the columns as an aligned table
+	ReportFormatWide = "wide"
+	// ReportFormatJSON writes the entries as a JSON array
+	ReportFormatJSON = "json"
+	// ReportFormatYAML writes the entries as a YAML list
+	ReportFormatYAML = "yaml"
+)
+
+// WriteReport writes the entries with the given format
+func WriteReport(w io.Writer, entries []*Entry, format string) error {
+	if entries == nil {
+		entries = []*Entry{}
+	}
+	switch format {
+	case ReportFormatJSON:
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case ReportFormatYAML:
+		b, err := yaml.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+
+	case ReportFormatTable, ReportFormatWide:
+		return writeTable(w, entries, format == ReportFormatWide, time.Now())
+	}
+	return fmt.Errorf("invalid report format %q, must be one of %s, %s, %s, %s", format, ReportFormatTable, ReportFormatWide, ReportFormatJSON, ReportFormatYAML)
+}
+
+func writeTable(w io.Writer, entries []*Entry, wide bool, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := "NAME\tCN\tSANS\tKEY\tCONDITION\tFETCHES\tLAST FETCH\tEXPIRES\tGC"
+	if wide {
+		header += "\tREQUESTER\tAGE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, e := range entries {
+		key, lastFetch, expires := "<none>", "<none>", "<none>"
+		if e.Key != nil {
+			key = fmt.Sprintf("%s-%d", e.Key.Type, e.Key.Size)
+		}
+		if e.LastFetch != nil {
+			lastFetch = shortDuration(now.Sub(*e.LastFetch)) + " ago"
+		}
+		if e.NotAfter != nil {
+			left := e.NotAfter.Sub(now)
+			expires = "in " + shortDuration(left)
+			if left <= 0 {
+				expires = "expired " + shortDuration(-left) + " ago"
+			}
+		}
+		var gc []string
+		for _, eligibility := range e.GC {
+			if !wide {
+				gc = append(gc, eligibility.Predicate)
+				continue
+			}
+			gc = append(gc, fmt.Sprintf("%s(%s)", eligibility.Predicate, shortDuration(eligibility.GracePeriodLeft)))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s",
+			e.Name, orNone(e.CommonName), orNone(strings.Join(e.SANs, ",")), key, e.Condition, e.FetchCount, lastFetch, expires, orNone(strings.Join(gc, ",")))
+		if wide {
+			fmt.Fprintf(tw, "\t%s\t%s", e.Requester, shortDuration(now.Sub(e.Created)))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// shortDuration formats the duration with its two most significant units like 3d4h, 5h2m, 4m10s
+func shortDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	d = d.Round(time.Second)
+	days, hours, minutes, seconds := int(d/(time.Hour*24)), int(d/time.Hour)%24, int(d/time.Minute)%60, int(d/time.Second)%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
@@ -12,9 +12,14 @@ type Approval struct {
 	kubeClient *kubeclient.KubeClient
 }
 
-// NewApproval creates a new Approval
+// NewApproval creates a new Approval, pass kubeConfigPath == "" to use the InCluster config
 func NewApproval(kubeConfigPath string) (*Approval, error) {
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	return NewApprovalFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath})
+}
+
+// NewApprovalFromConfig is the NewApproval with the context, the impersonation and the tuning of the Kubernetes client
+func NewApprovalFromConfig(kubeConfig *kubeclient.Config) (*Approval, error) {
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,10 @@
 package fetch
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
 	"time"
 
 	"github.com/golang/glog"
@@ -47,8 +46,13 @@ type Fetch struct {
 	kubeClient *kubeclient.KubeClient
 }
 
-// NewFetcher creates a new Fetch
+// NewFetcher creates a new Fetch, pass kubeConfigPath == "" to use the InCluster config
 func NewFetcher(kubeConfigPath string, conf *Config) (*Fetch, error) {
+	return NewFetcherFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath}, conf)
+}
+
+// NewFetcherFromConfig is the NewFetcher with the context, the impersonation and the tuning of the Kubernetes client
+func NewFetcherFromConfig(kubeConfig *kubeclient.Config, conf *Config) (*Fetch, error) {
 	if conf.PollingInterval == 0 {
 		err := fmt.Errorf("invalid value for PollingInterval: %s", conf.PollingInterval.String())
 		glog.Errorf("Cannot use the provided config: %v", err)
@@ -59,7 +63,7 @@ func NewFetcher(kubeConfigPath string, conf *Config) (*Fetch, error) {
 		glog.Errorf("Cannot use the provided config: %v", err)
 		return nil, err
 	}
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -101,25 +105,21 @@ func (f *Fetch) updateAnnotations(r *certificates.CertificateSigningRequest) err
 	return nil
 }
 
-// Fetch the generated certificate from the CSR
-func (f *Fetch) Fetch(csrName string) error {
+// Fetch the generated certificate from the CSR, returns when the context is done
+func (f *Fetch) Fetch(ctx context.Context, csrName string) error {
 	glog.V(0).Infof("Start polling for certificate of csr/%s, every %s, timeout after %s", csrName, f.Conf.PollingInterval.String(), f.Conf.PollingTimeout.String())
 
 	tick := time.NewTicker(f.Conf.PollingInterval)
 	defer tick.Stop()
 
 	timeout := time.NewTimer(f.Conf.PollingTimeout)
-	defer tick.Stop()
-
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(ch)
+	defer timeout.Stop()
 
 	for {
 		select {
-		case s := <-ch:
-			glog.Infof("Signal %s received, exiting ...", s.String())
-			return fmt.Errorf("%s", s.String())
+		case <-ctx.Done():
+			glog.Infof("Stop polling for certificate of csr/%s: %v", csrName, ctx.Err())
+			return ctx.Err()
 
 		case <-tick.C:
 			// TODO as we are waiting the ticker, if the ticker is set to 10s, we start polling after 10s
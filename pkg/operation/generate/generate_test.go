@@ -135,7 +135,7 @@ func TestGenerator(t *testing.T) {
 			g := NewGenerator(tc.conf)
 			err := g.Generate()
 			if tc.expectedErr == "" && err != nil {
-				t.Errorf(err.Error())
+				t.Error(err)
 			}
 			if tc.expectedErr != "" {
 				assert.Equal(t, tc.expectedErr, err.Error())
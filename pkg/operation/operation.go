@@ -1,6 +1,8 @@
 package operation
 
 import (
+	"context"
+
 	"github.com/golang/glog"
 
 	"github.com/JulienBalestra/kube-csr/pkg/operation/approve"
@@ -59,41 +61,57 @@ func (o *Operation) submit() error {
 	return nil
 }
 
-// Run executes all the configured operations
-func (o *Operation) Run() error {
+// Run executes all the configured operations, the cancellation of the context
+// is propagated to the operation in flight and stops the next ones
+func (o *Operation) Run(ctx context.Context) error {
 	glog.V(0).Infof("Running operations ...")
 	o.approved = false
 	if o.Query != nil {
-		sans, err := o.Query.GetKubernetesServicesSubjectAlternativeNames()
+		sans, err := o.Query.GetKubernetesServicesSubjectAlternativeNames(ctx)
 		if err != nil {
 			return err
 		}
 		o.SourceConfig.Hosts = append(o.SourceConfig.Hosts, sans...)
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if o.Generate != nil {
 		err := o.Generate.Generate()
 		if err != nil {
 			return err
 		}
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if o.Submit != nil {
 		err := o.submit()
 		if err != nil {
 			return err
 		}
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if o.Approve != nil && !o.approved {
 		err := o.Approve.GetAndApproveCSR(o.SourceConfig.Name)
 		if err != nil {
 			return err
 		}
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if o.Fetch != nil {
-		err := o.Fetch.Fetch(o.SourceConfig.Name)
+		err := o.Fetch.Fetch(ctx, o.SourceConfig.Name)
 		if err != nil {
 			return err
 		}
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if o.Purge != nil {
 		err := o.Purge.Delete(o.SourceConfig.Name)
 		if err != nil {
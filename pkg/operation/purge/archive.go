@@ -0,0 +1,178 @@
+package purge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// Archiver records the csr before their deletion by the GC
+type Archiver interface {
+	Archive(r *Record) error
+	String() string
+}
+
+// Condition of an archived csr
+type Condition struct {
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason,omitempty"`
+	Message        string    `json:"message,omitempty"`
+	LastUpdateTime time.Time `json:"lastUpdateTime"`
+}
+
+// Record is the archive of a csr and its certificate
+type Record struct {
+	Name        string      `json:"name"`
+	UID         string      `json:"uid"`
+	Reason      string      `json:"reason"`
+	ArchiveTime time.Time   `json:"archiveTime"`
+	Requester   string      `json:"requester"`
+	Groups      []string    `json:"groups,omitempty"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+	Subject     string      `json:"subject,omitempty"`
+	SANs        []string    `json:"sans,omitempty"`
+	Serial      string      `json:"serial,omitempty"`
+	NotBefore   *time.Time  `json:"notBefore,omitempty"`
+	NotAfter    *time.Time  `json:"notAfter,omitempty"`
+	Certificate string      `json:"certificate,omitempty"`
+}
+
+// NewRecord decodes the csr and its certificate, if any, to archive them
+// the subject and the SANs come from the request of the csr without certificate
+func NewRecord(csr *certificates.CertificateSigningRequest, reason string, now time.Time) *Record {
+	r := &Record{
+		Name:        csr.Name,
+		UID:         string(csr.UID),
+		Reason:      reason,
+		ArchiveTime: now.UTC(),
+		Requester:   csr.Spec.Username,
+		Groups:      csr.Spec.Groups,
+	}
+	for _, c := range csr.Status.Conditions {
+		r.Conditions = append(r.Conditions, Condition{
+			Type:           string(c.Type),
+			Reason:         c.Reason,
+			Message:        c.Message,
+			LastUpdateTime: c.LastUpdateTime.UTC(),
+		})
+	}
+	if csr.Status.Certificate != nil {
+		r.Certificate = string(csr.Status.Certificate)
+		cert, err := pemio.ParseCertificate(csr.Status.Certificate)
+		if err != nil {
+			glog.Errorf("Cannot parse the certificate of csr/%s uid: %s: %v", csr.Name, csr.UID, err)
+			return r
+		}
+		notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+		r.Subject = cert.Subject.String()
+		r.SANs = pemio.SubjectAlternativeNames(cert.DNSNames, cert.IPAddresses)
+		r.Serial = cert.SerialNumber.String()
+		r.NotBefore, r.NotAfter = &notBefore, &notAfter
+		return r
+	}
+	req, err := pemio.ParseCertificateRequest(csr.Spec.Request)
+	if err != nil {
+		glog.V(1).Infof("Cannot parse the request of csr/%s uid: %s: %v", csr.Name, csr.UID, err)
+		return r
+	}
+	r.Subject = req.Subject.String()
+	r.SANs = pemio.SubjectAlternativeNames(req.DNSNames, req.IPAddresses)
+	return r
+}
+
+// FileArchiver appends the records as JSON lines to a file
+// the file is rotated once it would exceed MaxSize bytes, MaxBackups rotated files are kept as file.1, file.2 ...
+type FileArchiver struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu sync.Mutex
+}
+
+// NewFileArchiver creates a new FileArchiver
+func NewFileArchiver(path string, maxSize int64, maxBackups int) (*FileArchiver, error) {
+	if maxSize <= 0 || maxBackups < 0 {
+		err := fmt.Errorf("invalid archive limits: max size %d, max backups %d", maxSize, maxBackups)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	return &FileArchiver{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}, nil
+}
+
+func (a *FileArchiver) String() string {
+	return "file " + a.Path
+}
+
+func (a *FileArchiver) backupPath(i int) string {
+	return a.Path + "." + strconv.Itoa(i)
+}
+
+// rotate shifts the backups and removes the oldest one
+func (a *FileArchiver) rotate() error {
+	if a.MaxBackups == 0 {
+		return os.Remove(a.Path)
+	}
+	err := os.Remove(a.backupPath(a.MaxBackups))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := a.MaxBackups - 1; i > 0; i-- {
+		err = os.Rename(a.backupPath(i), a.backupPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(a.Path, a.backupPath(1))
+}
+
+// Archive appends the record to the file
+func (a *FileArchiver) Archive(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if int64(len(b)) > a.MaxSize {
+		return fmt.Errorf("archive of csr/%s is %d bytes, larger than the max size %d", r.Name, len(b), a.MaxSize)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fi, err := os.Stat(a.Path)
+	if err == nil && fi.Size()+int64(len(b)) > a.MaxSize {
+		glog.V(0).Infof("Rotating the archive %s of %d bytes", a.Path, fi.Size())
+		err = a.rotate()
+		if err != nil {
+			glog.Errorf("Cannot rotate the archive %s: %v", a.Path, err)
+			return err
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(a.Path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
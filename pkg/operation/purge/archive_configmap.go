@@ -0,0 +1,177 @@
+package purge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+)
+
+const (
+	// KubeCSRArchiveLabel groups the ConfigMaps of an archive
+	KubeCSRArchiveLabel = "kube-csr.io/archive"
+
+	// ConfigMapArchiveMaxSize keeps the archive ConfigMaps under the 1MiB limit of the kube-apiserver
+	ConfigMapArchiveMaxSize = 1000 * 1000
+)
+
+// ConfigMapArchiver stores the records as JSON in the data of ConfigMaps labeled with the archive name
+// a new ConfigMap is created once the current one would exceed MaxSize bytes, MaxBackups full ConfigMaps are kept
+// and the records of the older ones are dropped
+// The name and the size of the current ConfigMap are cached, the ConfigMaps are only listed to rotate them
+type ConfigMapArchiver struct {
+	Namespace  string
+	Name       string
+	MaxSize    int64
+	MaxBackups int
+
+	kubeClient  *kubeclient.KubeClient
+	mu          sync.Mutex
+	current     string
+	currentSize int64
+}
+
+// NewConfigMapArchiver creates a new ConfigMapArchiver
+func NewConfigMapArchiver(kubeConfig *kubeclient.Config, namespace, name string, maxSize int64, maxBackups int) (*ConfigMapArchiver, error) {
+	if maxSize <= 0 || maxSize > ConfigMapArchiveMaxSize || maxBackups < 0 {
+		err := fmt.Errorf("invalid archive limits: max size %d must be in (0, %d], max backups %d", maxSize, ConfigMapArchiveMaxSize, maxBackups)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigMapArchiver{
+		Namespace:  namespace,
+		Name:       name,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		kubeClient: k,
+	}, nil
+}
+
+func (a *ConfigMapArchiver) String() string {
+	return fmt.Sprintf("configmap %s/%s", a.Namespace, a.Name)
+}
+
+// configMapSize returns the size of the data of the ConfigMap
+func configMapSize(cm *v1.ConfigMap) int64 {
+	var size int64
+	for k, v := range cm.Data {
+		size += int64(len(k) + len(v))
+	}
+	return size
+}
+
+// list returns the ConfigMaps of the archive, the newest last
+func (a *ConfigMapArchiver) list() ([]v1.ConfigMap, error) {
+	cmList, err := a.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(a.Namespace).List(metav1.ListOptions{
+		LabelSelector: KubeCSRArchiveLabel + "=" + a.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cmList.Items, func(i, j int) bool {
+		return cmList.Items[i].Name < cmList.Items[j].Name
+	})
+	return cmList.Items, nil
+}
+
+// create starts a new ConfigMap and deletes the oldest ones beyond MaxBackups
+func (a *ConfigMapArchiver) create(cms []v1.ConfigMap) (*v1.ConfigMap, error) {
+	cm, err := a.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(a.Namespace).Create(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			// the suffix sorts the ConfigMaps by creation
+			Name:      fmt.Sprintf("%s-%d", a.Name, time.Now().UnixNano()),
+			Namespace: a.Namespace,
+			Labels: map[string]string{
+				KubeCSRArchiveLabel: a.Name,
+			},
+		},
+	})
+	if err != nil {
+		glog.Errorf("Cannot create a new ConfigMap for the archive %s: %v", a.String(), err)
+		return nil, err
+	}
+	glog.V(0).Infof("Created the ConfigMap %s/%s for the archive %s", cm.Namespace, cm.Name, a.Name)
+	for len(cms) > a.MaxBackups {
+		err = a.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(a.Namespace).Delete(cms[0].Name, &metav1.DeleteOptions{})
+		if err != nil {
+			glog.Errorf("Cannot delete the oldest ConfigMap %s/%s of the archive %s: %v", a.Namespace, cms[0].Name, a.Name, err)
+			break
+		}
+		glog.Warningf("Deleted the oldest ConfigMap %s/%s of the archive %s beyond the %d max backups, its records are dropped", a.Namespace, cms[0].Name, a.Name, a.MaxBackups)
+		cms = cms[1:]
+	}
+	return cm, nil
+}
+
+// rotate sets the current ConfigMap to the newest one of the archive if the record of the given size fits in,
+// otherwise to a new one
+func (a *ConfigMapArchiver) rotate(size int64) error {
+	cms, err := a.list()
+	if err != nil {
+		glog.Errorf("Cannot list the ConfigMaps of the archive %s: %v", a.String(), err)
+		return err
+	}
+	if len(cms) > 0 {
+		newest := &cms[len(cms)-1]
+		newestSize := configMapSize(newest)
+		if newestSize+size <= a.MaxSize {
+			a.current, a.currentSize = newest.Name, newestSize
+			return nil
+		}
+	}
+	cm, err := a.create(cms)
+	if err != nil {
+		return err
+	}
+	a.current, a.currentSize = cm.Name, 0
+	return nil
+}
+
+// Archive stores the record in the newest ConfigMap of the archive
+func (a *ConfigMapArchiver) Archive(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s.%s.json", r.Name, r.UID)
+	size := int64(len(key) + len(b))
+	if size > a.MaxSize {
+		return fmt.Errorf("archive of csr/%s is %d bytes, larger than the max size %d", r.Name, size, a.MaxSize)
+	}
+	patch, err := json.Marshal(map[string]map[string]string{
+		"data": {key: string(b)},
+	})
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current == "" || a.currentSize+size > a.MaxSize {
+		err = a.rotate(size)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = a.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(a.Namespace).Patch(a.current, types.MergePatchType, patch)
+	if err != nil {
+		glog.Errorf("Cannot update the ConfigMap %s/%s of the archive %s: %v", a.Namespace, a.current, a.Name, err)
+		// the next archive lists the ConfigMaps again
+		a.current, a.currentSize = "", 0
+		return err
+	}
+	a.currentSize += size
+	return nil
+}
@@ -0,0 +1,121 @@
+package purge
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+func TestNewRecord(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "csr",
+			UID:  "uid",
+		},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Username: "admin",
+			Groups:   []string{"system:masters"},
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Conditions: []certificates.CertificateSigningRequestCondition{
+				{
+					Type:           certificates.CertificateApproved,
+					Reason:         "AutoApproved",
+					LastUpdateTime: metav1.NewTime(now),
+				},
+			},
+			Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", notAfter),
+		},
+	}
+	r := NewRecord(csr, "fetched", now)
+	assert.Equal(t, "csr", r.Name)
+	assert.Equal(t, "uid", r.UID)
+	assert.Equal(t, "fetched", r.Reason)
+	assert.Equal(t, "admin", r.Requester)
+	assert.Equal(t, []string{"system:masters"}, r.Groups)
+	require.Len(t, r.Conditions, 1)
+	assert.Equal(t, "Approved", r.Conditions[0].Type)
+	assert.Equal(t, "1", r.Serial)
+	require.NotNil(t, r.NotAfter)
+	assert.Equal(t, notAfter, *r.NotAfter)
+	assert.Equal(t, string(csr.Status.Certificate), r.Certificate)
+
+	// without certificate the request is decoded
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app"},
+		DNSNames: []string{"app.default.svc"},
+	}, privateKey)
+	require.NoError(t, err)
+	csr.Status.Certificate = nil
+	csr.Spec.Request = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	r = NewRecord(csr, "stuck-approved", now)
+	assert.Equal(t, "CN=app", r.Subject)
+	assert.Equal(t, []string{"app.default.svc"}, r.SANs)
+	assert.Nil(t, r.NotAfter)
+	assert.Empty(t, r.Certificate)
+}
+
+func readLinesOrDie(t *testing.T, p string) []string {
+	f, err := os.Open(p)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	require.NoError(t, s.Err())
+	return lines
+}
+
+func TestFileArchiver(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	r := &Record{Name: "csr", UID: "uid", Reason: "fetched"}
+	b, err := json.Marshal(r)
+	require.NoError(t, err)
+	lineSize := int64(len(b) + 1)
+
+	archivePath := path.Join(tempDir, "archive", "csr.jsonl")
+	a, err := NewFileArchiver(archivePath, lineSize*2, 2)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, a.Archive(r))
+	}
+	assert.Len(t, readLinesOrDie(t, archivePath), 1)
+	assert.Len(t, readLinesOrDie(t, archivePath+".1"), 2)
+	assert.Len(t, readLinesOrDie(t, archivePath+".2"), 2)
+	_, err = os.Stat(archivePath + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	var decoded Record
+	require.NoError(t, json.Unmarshal([]byte(readLinesOrDie(t, archivePath)[0]), &decoded))
+	assert.Equal(t, "csr", decoded.Name)
+
+	// a record larger than the max size
+	a, err = NewFileArchiver(archivePath, lineSize-1, 2)
+	require.NoError(t, err)
+	assert.Error(t, a.Archive(r))
+}
@@ -0,0 +1,53 @@
+package purge
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/revoke"
+)
+
+// KubeCSRRetainAnnotation protects the annotated csr from the GC when set to "true"
+const KubeCSRRetainAnnotation = "kube-csr.io/retain"
+
+// isRequestedBy returns if the username or one of the groups of the requester of the csr is in the requestors
+func isRequestedBy(csr *certificates.CertificateSigningRequest, requestors []string) bool {
+	for _, requestor := range requestors {
+		if csr.Spec.Username == requestor {
+			return true
+		}
+		for _, group := range csr.Spec.Groups {
+			if group == requestor {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isExcluded returns if the GC must ignore the csr:
+// - out of the name prefix or the requestors
+// - retained by annotation
+// - revoked, kept for audit
+func (p *Purge) isExcluded(csr *certificates.CertificateSigningRequest) bool {
+	if !strings.HasPrefix(csr.Name, p.conf.NamePrefix) {
+		glog.V(4).Infof("csr/%s uid: %s does not start with %q, ignoring", csr.Name, csr.UID, p.conf.NamePrefix)
+		return true
+	}
+	if len(p.conf.Requestors) > 0 && !isRequestedBy(csr, p.conf.Requestors) {
+		glog.V(4).Infof("csr/%s uid: %s requested by %s is not requested by %s, ignoring", csr.Name, csr.UID, csr.Spec.Username, strings.Join(p.conf.Requestors, ","))
+		return true
+	}
+	if csr.Annotations[KubeCSRRetainAnnotation] == "true" {
+		glog.V(2).Infof("csr/%s uid: %s is retained by the annotation %s", csr.Name, csr.UID, KubeCSRRetainAnnotation)
+		return true
+	}
+	reason, revoked := revoke.IsRevoked(csr)
+	if revoked {
+		glog.V(2).Infof("csr/%s uid: %s is revoked, keeping it for audit: %q", csr.Name, csr.UID, reason)
+		return true
+	}
+	return false
+}
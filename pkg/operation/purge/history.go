@@ -0,0 +1,165 @@
+package purge
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// KeepLastReason is the reason of the deletes of the csr beyond the KeepLast history
+const KeepLastReason = "keep-last"
+
+// historyGroup returns the common name of the csr request or the value of the KeepLastGroupLabel,
+// false when the csr cannot be grouped
+func (p *Purge) historyGroup(csr *certificates.CertificateSigningRequest) (string, bool) {
+	if p.conf.KeepLastGroupLabel != "" {
+		group, ok := csr.Labels[p.conf.KeepLastGroupLabel]
+		return group, ok && group != ""
+	}
+	req, err := pemio.ParseCertificateRequest(csr.Spec.Request)
+	if err != nil {
+		glog.V(2).Infof("Cannot parse the request of csr/%s uid: %s to group its history: %v", csr.Name, csr.UID, err)
+		return "", false
+	}
+	return req.Subject.CommonName, req.Subject.CommonName != ""
+}
+
+// historyEntry is the part of a csr kept during a sweep to compute the history of its group
+type historyEntry struct {
+	name      string
+	uid       types.UID
+	requester string
+	created   metav1.Time
+	state     string
+	// excluded entries count in the history of their group but are never deleted
+	excluded bool
+	// beyondSince is when the entry went beyond the history: the creation of the KeepLast-th most recent issued csr of its group
+	beyondSince time.Time
+}
+
+// addHistory appends the csr to its group when the KeepLast is positive and the csr can be grouped
+func (p *Purge) addHistory(groups map[string][]historyEntry, csr *certificates.CertificateSigningRequest, excluded bool) {
+	if p.conf.KeepLast <= 0 {
+		return
+	}
+	group, ok := p.historyGroup(csr)
+	if !ok {
+		return
+	}
+	groups[group] = append(groups[group], historyEntry{
+		name:      csr.Name,
+		uid:       csr.UID,
+		requester: csr.Spec.Username,
+		created:   csr.CreationTimestamp,
+		state:     CSRState(csr),
+		excluded:  excluded,
+	})
+}
+
+// beyondGroups returns the entries created before the KeepLast most recent issued entries of their group, sorted by name
+// the excluded entries are never returned
+func (p *Purge) beyondGroups(groups map[string][]historyEntry) []historyEntry {
+	var beyond []historyEntry
+	if p.conf.KeepLast <= 0 {
+		return beyond
+	}
+	for group, entries := range groups {
+		// most recent first
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[j].created.Before(&entries[i].created)
+		})
+		issued := 0
+		for i, entry := range entries {
+			if entry.state == StateIssued {
+				issued++
+			}
+			if issued < p.conf.KeepLast {
+				continue
+			}
+			for _, older := range entries[i+1:] {
+				if older.excluded {
+					continue
+				}
+				glog.V(2).Infof("csr/%s uid: %s is older than the last %d issued csr of %q", older.name, older.uid, p.conf.KeepLast, group)
+				older.beyondSince = entry.created.Time
+				beyond = append(beyond, older)
+			}
+			break
+		}
+	}
+	sort.Slice(beyond, func(i, j int) bool {
+		return beyond[i].name < beyond[j].name
+	})
+	return beyond
+}
+
+// keepLastCandidate returns the candidate of an entry beyond the history, deleted once the grace period is elapsed
+func (p *Purge) keepLastCandidate(entry *historyEntry, now time.Time) *Candidate {
+	left := entry.beyondSince.Add(p.conf.GracePeriod).Sub(now)
+	return &Candidate{
+		Name:            entry.name,
+		Predicate:       KeepLastReason,
+		Requester:       entry.requester,
+		Age:             now.Sub(entry.created.Time),
+		GracePeriodLeft: left,
+		Delete:          left <= 0,
+	}
+}
+
+// deleteBeyondHistory deletes the csr beyond the history of the complete sweep, once their grace period is elapsed
+// the deletes are limited by the MaxDeletesPerRun and paced by the DeleteQPS like the ones of the predicates,
+// the csr left are deleted at the end of the next sweep
+func (p *Purge) deleteBeyondHistory(ctx context.Context, purged, errs *int) error {
+	now := time.Now()
+	beyond := p.beyondGroups(p.sweepHistory)
+	for i := range beyond {
+		entry := &beyond[i]
+		c := p.keepLastCandidate(entry, now)
+		if !c.Delete {
+			glog.V(2).Infof("csr/%s uid: %s is beyond the history but still in grace period for %s", entry.name, entry.uid, durationFormat(c.GracePeriodLeft))
+			continue
+		}
+		if ctx.Err() != nil {
+			glog.V(0).Infof("Stop garbage collect after %d csr: %v", *purged, ctx.Err())
+			return ctx.Err()
+		}
+		if p.conf.MaxDeletesPerRun > 0 && *purged+*errs >= p.conf.MaxDeletesPerRun {
+			glog.V(0).Infof("Reached the max of %d deletes per run, the csr beyond the history are deleted by the next sweep", p.conf.MaxDeletesPerRun)
+			return nil
+		}
+		err := p.waitDeleteRate(ctx)
+		if err != nil {
+			glog.V(0).Infof("Stop garbage collect after %d csr: %v", *purged, err)
+			return err
+		}
+		// the csr is read again to archive it, it could have been deleted or replaced since the page
+		csr, err := p.kubeClient.GetCertificateClient().CertificateSigningRequests().Get(entry.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) || err == nil && csr.UID != entry.uid {
+			glog.V(1).Infof("csr/%s uid: %s is already deleted", entry.name, entry.uid)
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Cannot get csr/%s: %v", entry.name, err)
+			p.promDeleteCounterError.WithLabelValues(KeepLastReason).Inc()
+			*errs++
+			continue
+		}
+		glog.V(1).Infof("Deleting csr/%s uid: %s: %s", csr.Name, csr.UID, KeepLastReason)
+		err = p.deleteCSR(csr, KeepLastReason)
+		if err != nil {
+			*errs++
+			continue
+		}
+		p.sweepStates[entry.state]--
+		*purged++
+	}
+	return nil
+}
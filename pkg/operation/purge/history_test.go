@@ -0,0 +1,89 @@
+package purge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+func TestBeyondHistory(t *testing.T) {
+	now := time.Now()
+	appRequest, dbRequest := pemtest.GenerateRequestOrDie(pemtest.GenerateKeyOrDie(), "app"), pemtest.GenerateRequestOrDie(pemtest.GenerateKeyOrDie(), "db")
+	newCSR := func(uid string, request []byte, age time.Duration, issued bool, labels map[string]string) certificates.CertificateSigningRequest {
+		csr := certificates.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              uid,
+				UID:               types.UID(uid),
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				Labels:            labels,
+			},
+			Spec: certificates.CertificateSigningRequestSpec{
+				Request: request,
+			},
+		}
+		if issued {
+			csr.Status.Certificate = []byte("issued")
+		}
+		return csr
+	}
+	csrs := []certificates.CertificateSigningRequest{
+		newCSR("app-0", appRequest, time.Hour*5, true, map[string]string{"owner": "a"}),
+		newCSR("app-1", appRequest, time.Hour*4, false, map[string]string{"owner": "a"}),
+		newCSR("app-2", appRequest, time.Hour*3, true, map[string]string{"owner": "a"}),
+		// pending csr more recent than the last issued ones are kept
+		newCSR("app-4", appRequest, time.Hour*1, false, map[string]string{"owner": "b"}),
+		newCSR("app-3", appRequest, time.Hour*2, true, map[string]string{"owner": "b"}),
+		newCSR("db-0", dbRequest, time.Hour*5, true, nil),
+		newCSR("db-1", dbRequest, time.Hour*4, true, nil),
+		newCSR("invalid", nil, time.Hour*10, true, nil),
+	}
+
+	p := &Purge{conf: &Config{}}
+	beyondHistory := func() map[types.UID]time.Time {
+		groups := make(map[string][]historyEntry)
+		for i := range csrs {
+			p.addHistory(groups, &csrs[i], csrs[i].Name == "app-1")
+		}
+		beyond := make(map[types.UID]time.Time)
+		for _, entry := range p.beyondGroups(groups) {
+			beyond[entry.uid] = entry.beyondSince
+		}
+		return beyond
+	}
+	assert.Empty(t, beyondHistory())
+
+	p.conf.KeepLast = 2
+	// the excluded app-1 counts in the history but is never beyond it
+	assert.Equal(t, map[types.UID]time.Time{
+		"app-0": csrs[2].CreationTimestamp.Time,
+	}, beyondHistory())
+
+	p.conf.KeepLast = 1
+	assert.Equal(t, map[types.UID]time.Time{
+		"app-0": csrs[4].CreationTimestamp.Time,
+		"app-2": csrs[4].CreationTimestamp.Time,
+		"db-0":  csrs[6].CreationTimestamp.Time,
+	}, beyondHistory())
+
+	p.conf.KeepLastGroupLabel = "owner"
+	assert.Equal(t, map[types.UID]time.Time{
+		"app-0": csrs[2].CreationTimestamp.Time,
+	}, beyondHistory())
+
+	// the grace period starts when the csr goes beyond the history
+	p.conf.GracePeriod = time.Hour * 2
+	entry := &historyEntry{name: "app-0", created: csrs[0].CreationTimestamp, beyondSince: csrs[2].CreationTimestamp.Time}
+	c := p.keepLastCandidate(entry, now)
+	assert.Equal(t, KeepLastReason, c.Predicate)
+	assert.True(t, c.Delete)
+	entry.beyondSince = csrs[3].CreationTimestamp.Time
+	c = p.keepLastCandidate(entry, now)
+	assert.False(t, c.Delete)
+	assert.Equal(t, time.Hour, c.GracePeriodLeft)
+}
@@ -0,0 +1,225 @@
+package purge
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+)
+
+// Predicate selects the csr to garbage collect once its grace period is elapsed
+// Since returns when the csr entered the state matched by the predicate, the grace period starts at this time
+type Predicate struct {
+	Name  string
+	Since func(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool)
+}
+
+var (
+	// CertificateExpired matches the csr with an expired certificate, since its "Not After"
+	CertificateExpired = &Predicate{Name: "expired", Since: certificateExpiredSince}
+	// ConditionDenied matches the denied csr, since the last update of the condition
+	ConditionDenied = &Predicate{Name: "denied", Since: conditionDeniedSince}
+	// AnnotationFetched matches the already fetched csr, since the last fetch
+	AnnotationFetched = &Predicate{Name: "fetched", Since: annotationFetchedSince}
+	// Pending matches the csr never approved nor denied, since its creation
+	Pending = &Predicate{Name: "pending", Since: pendingSince}
+	// StuckApproved matches the approved csr without any certificate issued by the signer, since the approval
+	StuckApproved = &Predicate{Name: "stuck-approved", Since: stuckApprovedSince}
+)
+
+// AllPredicates are the reasons of the deletes
+var AllPredicates = []*Predicate{CertificateExpired, ConditionDenied, AnnotationFetched, Pending, StuckApproved}
+
+// ShouldGCReason is the reason of the deletes matched by the ShouldGC functions of the Config
+const ShouldGCReason = "should-gc"
+
+// States of the csr reported by the metrics
+const (
+	StatePending  = "pending"
+	StateApproved = "approved"
+	StateIssued   = "issued"
+	StateDenied   = "denied"
+)
+
+// getCondition returns the first condition of the given type
+func getCondition(csr *certificates.CertificateSigningRequest, conditionType certificates.RequestConditionType) (*certificates.CertificateSigningRequestCondition, bool) {
+	for i := range csr.Status.Conditions {
+		if csr.Status.Conditions[i].Type == conditionType {
+			return &csr.Status.Conditions[i], true
+		}
+	}
+	return nil, false
+}
+
+// CSRState returns the state of the csr: pending, approved without certificate, issued or denied
+func CSRState(csr *certificates.CertificateSigningRequest) string {
+	_, denied := getCondition(csr, certificates.CertificateDenied)
+	if denied {
+		return StateDenied
+	}
+	if csr.Status.Certificate != nil {
+		return StateIssued
+	}
+	_, approved := getCondition(csr, certificates.CertificateApproved)
+	if approved {
+		return StateApproved
+	}
+	return StatePending
+}
+
+// GracePeriodLeft returns the duration left before the csr can be garbage collected and if the predicate matches
+func (pr *Predicate) GracePeriodLeft(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration, now time.Time) (time.Duration, bool) {
+	since, ok := pr.Since(csr, now)
+	if !ok {
+		return 0, false
+	}
+	return since.Add(gracePeriod).Sub(now), true
+}
+
+// ShouldGC returns if the predicate matches the csr and the grace period is elapsed
+func (pr *Predicate) ShouldGC(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
+	left, ok := pr.GracePeriodLeft(csr, gracePeriod, time.Now())
+	if !ok {
+		return false
+	}
+	if left > 0 {
+		glog.V(2).Infof("csr/%s uid: %s is %s but still in grace period for %s", csr.Name, csr.UID, pr.Name, durationFormat(left))
+		return false
+	}
+	glog.V(2).Infof("csr/%s uid: %s can be GC, %s", csr.Name, csr.UID, pr.Name)
+	return true
+}
+
+// NewShouldGCPredicate adapts a ShouldGC function, it matches once the function returns true with the gracePeriod
+func NewShouldGCPredicate(fn func(*certificates.CertificateSigningRequest, time.Duration) bool, gracePeriod time.Duration) *Predicate {
+	return &Predicate{
+		Name: ShouldGCReason,
+		Since: func(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+			if !fn(csr, gracePeriod) {
+				return time.Time{}, false
+			}
+			// the function already waited the grace period
+			return now.Add(-gracePeriod), true
+		},
+	}
+}
+
+// allPredicates returns the Predicates followed by the adapted ShouldGC functions
+func (c *Config) allPredicates() []*Predicate {
+	if len(c.ShouldGC) == 0 {
+		return c.Predicates
+	}
+	predicates := append([]*Predicate{}, c.Predicates...)
+	for _, fn := range c.ShouldGC {
+		predicates = append(predicates, NewShouldGCPredicate(fn, c.GracePeriod))
+	}
+	return predicates
+}
+
+func certificateExpiredSince(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+	if csr.Status.Certificate == nil {
+		glog.V(2).Infof("csr/%s uid: %s does not have any certificate", csr.Name, csr.UID)
+		return time.Time{}, false
+	}
+	block, rest := pem.Decode(csr.Status.Certificate)
+	if block == nil || len(rest) > 0 {
+		glog.Errorf("Unexpected result after certificate decode of csr/%s uid %s %s", csr.Name, csr.UID, string(rest))
+		return time.Time{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		glog.Errorf("Cannot parse certificate of csr/%s uid %s: %v", csr.Name, csr.UID, err)
+		return time.Time{}, false
+	}
+	if now.Before(cert.NotAfter) {
+		glog.V(2).Infof("csr/%s uid %s not expired, NotAfter: %s, still %s", csr.Name, csr.UID, cert.NotAfter.Format(fetch.KubeCsrFetchedAnnotationDateFormat), durationFormat(cert.NotAfter.Sub(now)))
+		return time.Time{}, false
+	}
+	glog.V(2).Infof("csr/%s uid: %s expired since %s", csr.Name, csr.UID, durationFormat(now.Sub(cert.NotAfter)))
+	return cert.NotAfter, true
+}
+
+func conditionDeniedSince(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+	nbCondition := len(csr.Status.Conditions)
+	if nbCondition == 0 {
+		glog.V(2).Infof("csr/%s uid: %s does not have any condition", csr.Name, csr.UID)
+		return time.Time{}, false
+	}
+	if nbCondition != 1 {
+		glog.Warningf("csr/%s uid: %s has an unexpected number of conditions: %d", csr.Name, csr.UID, nbCondition)
+	}
+	condition := csr.Status.Conditions[0]
+	if condition.Type != certificates.CertificateDenied {
+		glog.V(2).Infof("csr/%s uid: %s does not start with condition %q: %q", csr.Name, csr.UID, certificates.CertificateDenied, condition.Type)
+		return time.Time{}, false
+	}
+	glog.V(1).Infof("csr/%s uid: %s is %q since %s", csr.Name, csr.UID, certificates.CertificateDenied, condition.LastUpdateTime.Format(fetch.KubeCsrFetchedAnnotationDateFormat))
+	return condition.LastUpdateTime.Time, true
+}
+
+func annotationFetchedSince(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+	if csr.Annotations == nil {
+		glog.V(2).Infof("csr/%s uid: %s does not have any annotation", csr.Name, csr.UID)
+		return time.Time{}, false
+	}
+	nbString := csr.Annotations[fetch.KubeCsrFetchedAnnotationNb]
+	nb, err := strconv.Atoi(nbString)
+	if err != nil {
+		glog.V(2).Infof("csr/%s uid: %s does not have a valid annotation %s: %q", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationNb, nbString)
+		return time.Time{}, false
+	}
+	glog.V(2).Infof("csr/%s uid: %s has been fetched %d times", csr.Name, csr.UID, nb)
+	if nb == 0 {
+		return time.Time{}, false
+	}
+
+	lastFetchTimeStr, ok := csr.Annotations[fetch.KubeCsrFetchedAnnotationDate]
+	if !ok || lastFetchTimeStr == "" {
+		glog.V(2).Infof("csr/%s uid: %s does not have a valid annotation %s: %q", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationDate, lastFetchTimeStr)
+		return time.Time{}, false
+	}
+	lastFetchTime, err := time.Parse(fetch.KubeCsrFetchedAnnotationDateFormat, lastFetchTimeStr)
+	if err != nil {
+		glog.Errorf("Fail to parse csr/%s uid: %s annotation date %s: %q: %v", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationDate, lastFetchTimeStr, err)
+		return time.Time{}, false
+	}
+	glog.V(2).Infof("csr/%s uid: %s has been fetched on %s", csr.Name, csr.UID, lastFetchTime.Format(fetch.KubeCsrFetchedAnnotationDateFormat))
+	return lastFetchTime, true
+}
+
+func pendingSince(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+	if CSRState(csr) != StatePending {
+		return time.Time{}, false
+	}
+	glog.V(2).Infof("csr/%s uid: %s is pending since %s", csr.Name, csr.UID, durationFormat(now.Sub(csr.CreationTimestamp.Time)))
+	return csr.CreationTimestamp.Time, true
+}
+
+func stuckApprovedSince(csr *certificates.CertificateSigningRequest, now time.Time) (time.Time, bool) {
+	if CSRState(csr) != StateApproved {
+		return time.Time{}, false
+	}
+	condition, _ := getCondition(csr, certificates.CertificateApproved)
+	glog.V(2).Infof("csr/%s uid: %s is approved without certificate since %s", csr.Name, csr.UID, durationFormat(now.Sub(condition.LastUpdateTime.Time)))
+	return condition.LastUpdateTime.Time, true
+}
+
+// IsCertificateExpired returns if the certificate of the csr is expired according the "Not After" field
+func IsCertificateExpired(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
+	return CertificateExpired.ShouldGC(csr, gracePeriod)
+}
+
+// IsConditionDenied returns if the first condition of the csr is a type Denied
+func IsConditionDenied(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
+	return ConditionDenied.ShouldGC(csr, gracePeriod)
+}
+
+// IsAnnotationFetched returns if the csr has already been fetched according to the kube-csr annotations
+func IsAnnotationFetched(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
+	return AnnotationFetched.ShouldGC(csr, gracePeriod)
+}
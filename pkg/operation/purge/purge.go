@@ -1,45 +1,94 @@
 package purge
 
 import (
-	"crypto/x509"
-	"encoding/pem"
+	"context"
 	"fmt"
-	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
 	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
 	"github.com/JulienBalestra/kube-csr/pkg/utils/api"
 	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/leader"
 )
 
-// Config contains purge functions and the grace period
+// Config contains purge predicates and the grace period
 type Config struct {
+	Predicates []*Predicate
+	// ShouldGC are the functions of the previous releases, each one is adapted to a Predicate with the ShouldGCReason
 	ShouldGC                      []func(*certificates.CertificateSigningRequest, time.Duration) bool
 	GracePeriod                   time.Duration
 	PollingPeriod                 time.Duration
 	PrometheusExporterBindAddress string
+
+	// LabelSelector, NamePrefix and Requestors scope the csr considered by the GC
+	// a csr matches the Requestors with its username or one of its groups
+	LabelSelector string
+	NamePrefix    string
+	Requestors    []string
+
+	// KeepLast deletes the csr older than the KeepLast most recent issued ones of their group when positive
+	// the csr are grouped by the common name of their request or by the value of the KeepLastGroupLabel
+	KeepLast           int
+	KeepLastGroupLabel string
+
+	// ListPageSize limits the number of csr returned by each list, 0 lists all the csr at once
+	ListPageSize int64
+
+	// MaxDeletesPerRun stops a garbage collect after this number of deletes when positive,
+	// the next garbage collect resumes the listing from the page where the previous one stopped
+	MaxDeletesPerRun int
+
+	// DeleteQPS limits the number of deletes per second when positive
+	DeleteQPS float64
+
+	// Archiver records each csr before its deletion, a csr is not deleted when its archive fails
+	Archiver Archiver
+
+	// LeaderElection runs the gc loop only on the leader when not nil
+	LeaderElection *leader.Config
 }
 
 // Purge state
 type Purge struct {
 	conf       *Config
 	kubeClient *kubeclient.KubeClient
+	elector    *leader.Elector
 
 	promKubeAPICSR            prometheus.Gauge
 	promGarbageCollectLatency prometheus.Histogram
-	promDeleteCounter         prometheus.Counter
-	promDeleteCounterError    prometheus.Counter
+	promDeleteCounter         *prometheus.CounterVec
+	promDeleteCounterError    *prometheus.CounterVec
+	promLeader                prometheus.Gauge
+	promGarbageCollectErrors  prometheus.Counter
+	promCSRState              *prometheus.GaugeVec
+	promArchiveCounter        prometheus.Counter
+	promArchiveCounterError   prometheus.Counter
+
+	probeMu     sync.RWMutex
+	lastList    time.Time
+	lastListErr error
+	nextRun     time.Time
+	// lastProgress is the last list or delete of the current run, a long sweep paced by the DeleteQPS stays healthy
+	lastProgress time.Time
+
+	// the state of a garbage collect sweep, kept across the runs stopped by the MaxDeletesPerRun
+	sweepContinue string
+	sweepLastName string
+	sweepStates   map[string]int
+	sweepHistory  map[string][]historyEntry
+	sweepListed   int
+	sweepPurged   int
+	lastDelete    time.Time
 }
 
-// NewPurgeConfig returns a Purge Config
+// NewPurgeConfig returns a Purge Config with the ShouldGC functions
 func NewPurgeConfig(gracePeriod time.Duration, fns ...func(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool) *Config {
 	return &Config{
 		GracePeriod: gracePeriod,
@@ -47,6 +96,14 @@ func NewPurgeConfig(gracePeriod time.Duration, fns ...func(csr *certificates.Cer
 	}
 }
 
+// NewPurgeConfigWithPredicates returns a Purge Config with the Predicates
+func NewPurgeConfigWithPredicates(gracePeriod time.Duration, predicates ...*Predicate) *Config {
+	return &Config{
+		GracePeriod: gracePeriod,
+		Predicates:  predicates,
+	}
+}
+
 // RegisterPrometheusMetrics is a convenient function to create and register prometheus metrics
 func RegisterPrometheusMetrics(p *Purge) error {
 	p.promKubeAPICSR = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -57,14 +114,41 @@ func RegisterPrometheusMetrics(p *Purge) error {
 		Name: "kubernetes_csr_garbage_collect_latency_seconds",
 		Help: "Latency of garbage collection operations",
 	})
-	p.promDeleteCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	p.promDeleteCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "kubernetes_csr_deletes",
-		Help: "Total number of Kubernetes Certificate Signing Requests deleted",
-	})
-	p.promDeleteCounterError = prometheus.NewCounter(prometheus.CounterOpts{
+		Help: "Total number of Kubernetes Certificate Signing Requests deleted, by reason",
+	}, []string{"reason"})
+	p.promDeleteCounterError = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "kubernetes_csr_delete_errors",
-		Help: "Total number of Kubernetes Certificate Signing Requests deletion errors",
+		Help: "Total number of Kubernetes Certificate Signing Requests deletion errors, by reason",
+	}, []string{"reason"})
+	p.promLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kubernetes_csr_gc_leader",
+		Help: "Set to 1 when the gc loop is leading, 0 when standing by",
+	})
+	p.promGarbageCollectErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubernetes_csr_garbage_collect_errors",
+		Help: "Total number of garbage collection runs ended with an error",
+	})
+	p.promCSRState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubernetes_apiserver_csr_state",
+		Help: "Number of Kubernetes Certificate Signing Requests reported by the Kubernetes API, by state: pending, approved without certificate, issued and denied",
+	}, []string{"state"})
+	p.promArchiveCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubernetes_csr_archives",
+		Help: "Total number of Kubernetes Certificate Signing Requests archived before their deletion",
+	})
+	p.promArchiveCounterError = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kubernetes_csr_archive_errors",
+		Help: "Total number of Kubernetes Certificate Signing Requests archive errors",
 	})
+	// initialize the reasons to expose the counters before the first delete
+	for _, predicate := range AllPredicates {
+		p.promDeleteCounter.WithLabelValues(predicate.Name)
+		p.promDeleteCounterError.WithLabelValues(predicate.Name)
+	}
+	p.promDeleteCounter.WithLabelValues(KeepLastReason)
+	p.promDeleteCounterError.WithLabelValues(KeepLastReason)
 	err := prometheus.Register(p.promKubeAPICSR)
 	if err != nil {
 		return err
@@ -81,17 +165,47 @@ func RegisterPrometheusMetrics(p *Purge) error {
 	if err != nil {
 		return err
 	}
+	err = prometheus.Register(p.promLeader)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(p.promGarbageCollectErrors)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(p.promCSRState)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(p.promArchiveCounter)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(p.promArchiveCounterError)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-// NewPurge creates a new Fetch
+// NewPurge creates a new Fetch, pass kubeConfigPath == "" to use the InCluster config
 func NewPurge(kubeConfigPath string, conf *Config) (*Purge, error) {
+	return NewPurgeFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath}, conf)
+}
+
+// NewPurgeFromConfig is the NewPurge with the context, the impersonation and the tuning of the Kubernetes client
+func NewPurgeFromConfig(kubeConfig *kubeclient.Config, conf *Config) (*Purge, error) {
 	if conf.PollingPeriod == 0 {
 		err := fmt.Errorf("invalid value for PollingPeriod: %s", conf.PollingPeriod.String())
 		glog.Errorf("Cannot use the provided config: %v", err)
 		return nil, err
 	}
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	if conf.ListPageSize < 0 || conf.MaxDeletesPerRun < 0 || conf.DeleteQPS < 0 {
+		err := fmt.Errorf("negative value for ListPageSize: %d, MaxDeletesPerRun: %d or DeleteQPS: %g", conf.ListPageSize, conf.MaxDeletesPerRun, conf.DeleteQPS)
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +217,20 @@ func NewPurge(kubeConfigPath string, conf *Config) (*Purge, error) {
 	if err != nil {
 		return nil, err
 	}
+	if conf.LeaderElection == nil {
+		return p, nil
+	}
+	conf.LeaderElection.OnLeadershipChange = func(leading bool) {
+		if leading {
+			p.promLeader.Set(1)
+			return
+		}
+		p.promLeader.Set(0)
+	}
+	p.elector, err = leader.NewElector(kubeConfig, conf.LeaderElection)
+	if err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
@@ -127,173 +255,352 @@ func durationFormat(duration time.Duration) string {
 	return fmt.Sprintf("%d days and %s", days, duration.String())
 }
 
-// IsCertificateExpired returns if the certificate of the csr is expired according the "Not After" field
-func IsCertificateExpired(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
-	if csr.Status.Certificate == nil {
-		glog.V(2).Infof("csr/%s uid: %s does not have any certificate", csr.Name, csr.UID)
-		return false
-	}
-	block, rest := pem.Decode(csr.Status.Certificate)
-	if len(rest) > 0 {
-		glog.Errorf("Unexpected result after certificate decode of csr/%s uid %s %s", csr.Name, csr.UID, string(rest))
-		return false
-	}
-	cert, err := x509.ParseCertificate(block.Bytes)
+// Delete asked for a delete of the given csrName to the kube-apiserver
+func (p *Purge) Delete(csrName string) error {
+	err := p.kubeClient.GetCertificateClient().CertificateSigningRequests().Delete(csrName, &v1.DeleteOptions{})
 	if err != nil {
-		glog.Errorf("Cannot parse certificate of csr/%s uid %s: %v", csr.Name, csr.UID, err)
-		return false
-	}
-	now := time.Now()
-	if now.Before(cert.NotAfter) {
-		glog.V(2).Infof("csr/%s uid %s not expired, NotAfter: %s, still %s", csr.Name, csr.UID, cert.NotAfter.Format(fetch.KubeCsrFetchedAnnotationDateFormat), durationFormat(cert.NotAfter.Sub(now)))
-		return false
-	}
-	glog.V(2).Infof("csr/%s uid: %s expired since %s", csr.Name, csr.UID, durationFormat(time.Since(cert.NotAfter)))
-	gracePeriodLimit := now.Add(-gracePeriod)
-	if gracePeriodLimit.Before(cert.NotAfter) {
-		glog.V(2).Infof("csr/%s uid %s is expired but still in grace period of %s", csr.Name, csr.UID, durationFormat(cert.NotAfter.Sub(gracePeriodLimit)))
-		return false
+		glog.Errorf("Unexpected error during delete csr/%s: %v", csrName, err)
+		return err
 	}
-	return true
+	glog.V(0).Infof("Successfully deleted csr/%s", csrName)
+	return nil
 }
 
-// IsConditionDenied returns if the first condition of the csr is a type Denied
-func IsConditionDenied(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
-	nbCondition := len(csr.Status.Conditions)
-	if nbCondition == 0 {
-		glog.V(2).Infof("csr/%s uid: %s does not have any condition", csr.Name, csr.UID)
-		return false
-	}
-	if nbCondition != 1 {
-		glog.Warningf("csr/%s uid: %s has an unexpected number of conditions: %d", csr.Name, csr.UID, nbCondition)
-	}
-	condition := csr.Status.Conditions[0]
-	if condition.Type != certificates.CertificateDenied {
-		glog.V(2).Infof("csr/%s uid: %s does not start with condition %q: %q", csr.Name, csr.UID, certificates.CertificateDenied, condition.Type)
-		return false
-	}
-	glog.V(1).Infof("csr/%s uid: %s is %q", csr.Name, csr.UID, certificates.CertificateDenied)
+// listPage returns a page of at most ListPageSize csr matching the LabelSelector, starting at the continue token
+func (p *Purge) listPage(continueToken string) (*certificates.CertificateSigningRequestList, error) {
+	return p.kubeClient.GetCertificateClient().CertificateSigningRequests().List(v1.ListOptions{
+		LabelSelector: p.conf.LabelSelector,
+		Limit:         p.conf.ListPageSize,
+		Continue:      continueToken,
+	})
+}
 
-	now := time.Now()
-	gracePeriodLimit := now.Add(-gracePeriod)
-	glog.V(2).Infof("csr/%s uid: %s has been fetched on %s and grace period ends at %s", csr.Name, csr.UID, condition.LastUpdateTime.Format(fetch.KubeCsrFetchedAnnotationDateFormat), gracePeriodLimit.Format(fetch.KubeCsrFetchedAnnotationDateFormat))
-	if condition.LastUpdateTime.After(gracePeriodLimit) {
-		return false
-	}
-	glog.V(2).Infof("csr/%s uid: %s can be GC, has been %s", csr.Name, csr.UID, certificates.CertificateDenied)
-	return true
+// isExpired returns if the error is about an expired continue token
+func isExpired(err error) bool {
+	return errors.IsResourceExpired(err) || errors.IsGone(err)
 }
 
-// IsAnnotationFetched returns if the first condition of the csr is a type Denied
-func IsAnnotationFetched(csr *certificates.CertificateSigningRequest, gracePeriod time.Duration) bool {
-	if csr.Annotations == nil {
-		glog.V(2).Infof("csr/%s uid: %s does not have any annotation", csr.Name, csr.UID)
-		return false
-	}
-	nbString := csr.Annotations[fetch.KubeCsrFetchedAnnotationNb]
-	nb, err := strconv.Atoi(nbString)
-	if err != nil {
-		glog.V(2).Infof("csr/%s uid: %s does not have a valid annotation %s: %q", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationNb, nbString)
-		return false
+// listPages calls fn with each page of csr from the continue token to the last page, fn stops the list by returning false or an error
+// when the continue token is expired, restart is called and the list restarts from the first page
+func (p *Purge) listPages(ctx context.Context, continueToken string, restart func(), fn func(*certificates.CertificateSigningRequestList) (bool, error)) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		csrList, err := p.listPage(continueToken)
+		p.setListResult(err)
+		p.setProgress()
+		if isExpired(err) && continueToken != "" {
+			glog.Warningf("Cannot continue the list, restarting from the first page: %v", err)
+			restart()
+			continueToken = ""
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Cannot list all csr: %v", err)
+			return err
+		}
+		glog.V(2).Infof("Kube-apiserver returns a page of %d csr", len(csrList.Items))
+		next, err := fn(csrList)
+		if err != nil || !next || csrList.Continue == "" {
+			return err
+		}
+		continueToken = csrList.Continue
 	}
-	glog.V(2).Infof("csr/%s uid: %s has been fetched %d times", csr.Name, csr.UID, nb)
-	if nb == 0 {
-		return false
+}
+
+// resumeIndex returns the index of the first csr after lastName, the csr of a page are sorted by name
+func resumeIndex(csrs []certificates.CertificateSigningRequest, lastName string) int {
+	if lastName == "" {
+		return 0
 	}
+	return sort.Search(len(csrs), func(i int) bool {
+		return csrs[i].Name > lastName
+	})
+}
 
-	lastFetchTimeStr, ok := csr.Annotations[fetch.KubeCsrFetchedAnnotationDate]
-	if !ok || lastFetchTimeStr == "" {
-		glog.V(2).Infof("csr/%s uid: %s does not have a valid annotation %s: %q", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationDate, nbString)
-		return false
+// waitDeleteRate blocks until the DeleteQPS allows the next delete
+func (p *Purge) waitDeleteRate(ctx context.Context) error {
+	if p.conf.DeleteQPS <= 0 {
+		return nil
 	}
-	lastFetchTime, err := time.Parse(fetch.KubeCsrFetchedAnnotationDateFormat, lastFetchTimeStr)
-	if err != nil {
-		glog.Errorf("Fail to parse csr/%s uid: %s annotation date %s: %q: %v", csr.Name, csr.UID, fetch.KubeCsrFetchedAnnotationDate, lastFetchTimeStr, err)
-		return false
+	interval := time.Duration(float64(time.Second) / p.conf.DeleteQPS)
+	wait := time.Until(p.lastDelete.Add(interval))
+	if wait > 0 {
+		glog.V(3).Infof("Waiting %s before the next delete", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
 	}
+	p.lastDelete = time.Now()
+	return nil
+}
 
-	now := time.Now()
-	gracePeriodLimit := now.Add(-gracePeriod)
-	glog.V(2).Infof("csr/%s uid: %s has been fetched on %s and grace period ends at %s", csr.Name, csr.UID, lastFetchTime.Format(fetch.KubeCsrFetchedAnnotationDateFormat), gracePeriodLimit.Format(fetch.KubeCsrFetchedAnnotationDateFormat))
-	if lastFetchTime.After(gracePeriodLimit) {
-		return false
+// resetSweep starts a new garbage collect sweep from the first page
+func (p *Purge) resetSweep() {
+	p.sweepContinue, p.sweepLastName = "", ""
+	p.sweepListed, p.sweepPurged = 0, 0
+	p.sweepHistory = make(map[string][]historyEntry)
+	p.sweepStates = map[string]int{
+		StatePending:  0,
+		StateApproved: 0,
+		StateIssued:   0,
+		StateDenied:   0,
 	}
-	glog.V(2).Infof("csr/%s uid: %s can be GC, already fetched", csr.Name, csr.UID)
-	return true
 }
 
-// Delete asked for a delete of the given csrName to the kube-apiserver
-func (p *Purge) Delete(csrName string) error {
-	err := p.kubeClient.GetCertificateClient().CertificateSigningRequests().Delete(csrName, &v1.DeleteOptions{})
+// archive records the csr with the Archiver, if any
+func (p *Purge) archive(csr *certificates.CertificateSigningRequest, reason string) error {
+	if p.conf.Archiver == nil {
+		return nil
+	}
+	err := p.conf.Archiver.Archive(NewRecord(csr, reason, time.Now()))
 	if err != nil {
-		glog.Errorf("Unexpected error during delete csr/%s: %v", csrName, err)
+		glog.Errorf("Cannot archive csr/%s uid: %s in %s, skipping its delete: %v", csr.Name, csr.UID, p.conf.Archiver.String(), err)
+		p.promArchiveCounterError.Inc()
 		return err
 	}
-	glog.V(0).Infof("Successfully deleted csr/%s", csrName)
+	glog.V(1).Infof("Archived csr/%s uid: %s in %s", csr.Name, csr.UID, p.conf.Archiver.String())
+	p.promArchiveCounter.Inc()
 	return nil
 }
 
-// GarbageCollect iter over all CSR from the kube-apiserver and delete them if needed
-func (p *Purge) GarbageCollect() error {
-	now := time.Now().Unix()
-	csrList, err := p.kubeClient.GetCertificateClient().CertificateSigningRequests().List(v1.ListOptions{})
+// deleteCSR archives and deletes the csr, the deletes are counted by reason
+func (p *Purge) deleteCSR(csr *certificates.CertificateSigningRequest, reason string) error {
+	defer p.setProgress()
+	err := p.archive(csr, reason)
+	if err != nil {
+		return err
+	}
+	err = p.Delete(csr.Name)
 	if err != nil {
-		glog.Errorf("Cannot list all csr: %v", err)
+		p.promDeleteCounterError.WithLabelValues(reason).Inc()
 		return err
 	}
-	glog.V(2).Infof("Kube-apiserver returns %d csr", len(csrList.Items))
-	purged := 0
-	for _, elt := range csrList.Items {
-		glog.V(4).Infof("Got csr/%s", elt.Name)
-		for _, fn := range p.conf.ShouldGC {
-			if !fn(&elt, p.conf.GracePeriod) {
+	p.promDeleteCounter.WithLabelValues(reason).Inc()
+	p.sweepPurged++
+	return nil
+}
+
+// GarbageCollect iter over all CSR from the kube-apiserver and delete them if needed
+// Each csr is deleted once, with the first predicate matching after its grace period as reason
+// The csr beyond the KeepLast history are deleted at the end of the sweep, once their grace period is elapsed
+// The csr are listed by pages of ListPageSize, the deletes are paced by the DeleteQPS
+// When the MaxDeletesPerRun is reached, the next call resumes the sweep where this one stopped
+// The failed deletes are counted and reported at the end, the iteration stops when the context is done
+func (p *Purge) GarbageCollect(ctx context.Context) error {
+	start := time.Now()
+	if p.sweepStates == nil || p.sweepContinue == "" && p.sweepLastName == "" {
+		p.resetSweep()
+	} else {
+		glog.V(1).Infof("Resuming the garbage collect after csr/%s", p.sweepLastName)
+	}
+	purged, errs, complete := 0, 0, false
+	err := p.listPages(ctx, p.sweepContinue, p.resetSweep, func(csrList *certificates.CertificateSigningRequestList) (bool, error) {
+		for i := resumeIndex(csrList.Items, p.sweepLastName); i < len(csrList.Items); i++ {
+			if ctx.Err() != nil {
+				glog.V(0).Infof("Stop garbage collect after %d csr: %v", purged, ctx.Err())
+				return false, ctx.Err()
+			}
+			csr := &csrList.Items[i]
+			glog.V(4).Infof("Got csr/%s", csr.Name)
+			if p.isExcluded(csr) {
+				p.sweepStates[CSRState(csr)]++
+				p.addHistory(p.sweepHistory, csr, true)
+				p.sweepLastName = csr.Name
+				p.sweepListed++
+				continue
+			}
+			c := p.newCandidate(csr, time.Now())
+			if c == nil || !c.Delete {
+				p.sweepStates[CSRState(csr)]++
+				p.addHistory(p.sweepHistory, csr, false)
+				p.sweepLastName = csr.Name
+				p.sweepListed++
 				continue
 			}
-			err := p.Delete(elt.Name)
+			if p.conf.MaxDeletesPerRun > 0 && purged+errs >= p.conf.MaxDeletesPerRun {
+				// the page is listed again by the next run, from the same continue token
+				glog.V(0).Infof("Reached the max of %d deletes per run, resuming the next run before csr/%s", p.conf.MaxDeletesPerRun, csr.Name)
+				return false, nil
+			}
+			err := p.waitDeleteRate(ctx)
 			if err != nil {
-				return err
+				glog.V(0).Infof("Stop garbage collect after %d csr: %v", purged, err)
+				return false, err
+			}
+			p.sweepLastName = csr.Name
+			p.sweepListed++
+			glog.V(1).Infof("Deleting csr/%s uid: %s: %s", csr.Name, csr.UID, c.Predicate)
+			err = p.deleteCSR(csr, c.Predicate)
+			if err != nil {
+				p.sweepStates[CSRState(csr)]++
+				p.addHistory(p.sweepHistory, csr, false)
+				errs++
+				continue
 			}
-			p.promDeleteCounter.Inc()
 			purged++
 		}
+		if csrList.Continue != "" {
+			p.sweepContinue, p.sweepLastName = csrList.Continue, ""
+			return true, nil
+		}
+		complete = true
+		return false, p.deleteBeyondHistory(ctx, &purged, &errs)
+	})
+	if err != nil {
+		return err
 	}
+	return p.endGarbageCollect(start, purged, errs, complete)
+}
 
+// endGarbageCollect reports a garbage collect run, the csr metrics are updated once the sweep is complete
+func (p *Purge) endGarbageCollect(start time.Time, purged, errs int, complete bool) error {
 	// metrics
-	elapsedSeconds := time.Now().Unix() - now
-	p.promGarbageCollectLatency.Observe(float64(elapsedSeconds))
-	p.promKubeAPICSR.Set(float64(len(csrList.Items) - purged))
+	elapsed := time.Since(start)
+	p.promGarbageCollectLatency.Observe(elapsed.Seconds())
+	if complete {
+		for state, nb := range p.sweepStates {
+			p.promCSRState.WithLabelValues(state).Set(float64(nb))
+		}
+		// the csr reported by the Kubernetes API during the sweep, without the deleted ones
+		p.promKubeAPICSR.Set(float64(p.sweepListed - p.sweepPurged))
+		p.resetSweep()
+	}
 
 	// logging
+	if errs > 0 {
+		err := fmt.Errorf("failed to delete %d/%d csr", errs, errs+purged)
+		glog.Errorf("Garbage collected %d csr in %s: %v", purged, elapsed.Round(time.Millisecond), err)
+		return err
+	}
 	if purged > 0 {
-		glog.V(0).Infof("Successfully garbage collected %d csr in %ds", purged, elapsedSeconds)
+		glog.V(0).Infof("Successfully garbage collected %d csr in %s", purged, elapsed.Round(time.Millisecond))
 		return nil
 	}
-	glog.V(0).Infof("Ended without garbage collect in %ds", elapsedSeconds)
+	glog.V(0).Infof("Ended without garbage collect in %s", elapsed.Round(time.Millisecond))
 	return nil
 }
 
-// GarbageCollectLoop runs the GC on ticker, returns on error or SIGINT/TERM
-func (p *Purge) GarbageCollectLoop() error {
-	api.RegisterAPI(p.conf.PrometheusExporterBindAddress, api.PprofBindDefault)
+// setListResult records the result of the last list for the readiness probe
+func (p *Purge) setListResult(err error) {
+	p.probeMu.Lock()
+	p.lastList, p.lastListErr = time.Now(), err
+	p.probeMu.Unlock()
+}
+
+// setNextRun records the next scheduled run for the liveness probe
+func (p *Purge) setNextRun(nextRun time.Time) {
+	p.probeMu.Lock()
+	p.nextRun = nextRun
+	p.probeMu.Unlock()
+}
+
+// setProgress records the progress of the current run for the liveness probe
+func (p *Purge) setProgress() {
+	p.probeMu.Lock()
+	p.lastProgress = time.Now()
+	p.probeMu.Unlock()
+}
+
+// isStandingBy returns if the gc loop waits for the leadership
+func (p *Purge) isStandingBy() bool {
+	return p.elector != nil && !p.elector.IsLeader()
+}
+
+// Healthz fails when the gc loop is late of a full polling period after the scheduled run
+func (p *Purge) Healthz() (map[string]string, error) {
+	if p.isStandingBy() {
+		return map[string]string{"leader": "false"}, nil
+	}
+	p.probeMu.RLock()
+	nextRun, lastProgress := p.nextRun, p.lastProgress
+	p.probeMu.RUnlock()
+
+	details := map[string]string{
+		"nextRun":      nextRun.Format(time.RFC3339),
+		"lastProgress": lastProgress.Format(time.RFC3339),
+	}
+	if nextRun.IsZero() {
+		return details, fmt.Errorf("gc loop not started")
+	}
+	// a run longer than the PollingPeriod is healthy as long as it lists or deletes csr
+	deadline := nextRun
+	if lastProgress.After(deadline) {
+		deadline = lastProgress
+	}
+	if time.Now().After(deadline.Add(p.conf.PollingPeriod)) {
+		return details, fmt.Errorf("gc loop is stuck, the run scheduled at %s is late and the last progress was at %s", nextRun.Format(time.RFC3339), lastProgress.Format(time.RFC3339))
+	}
+	return details, nil
+}
+
+// Readyz fails until the last list of csr succeeded
+func (p *Purge) Readyz() (map[string]string, error) {
+	if p.isStandingBy() {
+		return map[string]string{"leader": "false"}, nil
+	}
+	p.probeMu.RLock()
+	lastList, lastListErr := p.lastList, p.lastListErr
+	p.probeMu.RUnlock()
+
+	if lastList.IsZero() {
+		return nil, fmt.Errorf("waiting for the first list of csr")
+	}
+	details := map[string]string{
+		"lastList": lastList.Format(time.RFC3339),
+	}
+	if lastListErr != nil {
+		return details, fmt.Errorf("last list of csr failed: %v", lastListErr)
+	}
+	return details, nil
+}
+
+// GarbageCollectLoop runs the GC on ticker, returns when the context is done
+// with the leader election, only the leader runs the GC and the followers stand by
+func (p *Purge) GarbageCollectLoop(ctx context.Context) error {
+	api.RegisterAPI(p.conf.PrometheusExporterBindAddress, api.PprofBindDefault, &api.Probes{
+		Healthz: p.Healthz,
+		Readyz:  p.Readyz,
+	})
+	if p.elector == nil {
+		p.promLeader.Set(1)
+		return p.garbageCollectLoop(ctx)
+	}
+	p.elector.Run(ctx, func(ctx context.Context) {
+		err := p.garbageCollectLoop(ctx)
+		if err != nil {
+			glog.Errorf("Unexpected error during the gc loop: %v", err)
+		}
+	})
+	return nil
+}
+
+func (p *Purge) garbageCollectLoop(ctx context.Context) error {
 	tick := time.NewTicker(p.conf.PollingPeriod)
 	defer tick.Stop()
-
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM)
-	defer close(ch)
+	p.setNextRun(time.Now().Add(p.conf.PollingPeriod))
 
 	glog.V(0).Infof("Starting gc loop, first run in %s", p.conf.PollingPeriod.String())
 	for {
 		select {
-		case <-ch:
-			glog.V(0).Infof("Exiting ...")
+		case <-ctx.Done():
+			glog.V(0).Infof("Exiting gc loop: %v", ctx.Err())
 			return nil
 
 		case <-tick.C:
-			err := p.GarbageCollect()
+			p.setNextRun(time.Now().Add(p.conf.PollingPeriod))
+			err := p.GarbageCollect(ctx)
+			if ctx.Err() != nil {
+				continue
+			}
 			if err != nil {
-				p.promDeleteCounterError.Inc()
+				// the failed deletes are counted by reason, the runs ended with an error are counted here
+				p.promGarbageCollectErrors.Inc()
+				glog.Errorf("GC run failed, next run in %s: %v", p.conf.PollingPeriod.String(), err)
+				continue
 			}
 			glog.V(0).Infof("GC loop, next run in %s", p.conf.PollingPeriod.String())
 		}
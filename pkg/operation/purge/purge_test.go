@@ -1,17 +1,16 @@
 package purge
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"math/big"
+	"context"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
 )
 
 func TestDurationFormat(t *testing.T) {
@@ -46,28 +45,6 @@ func TestDurationFormat(t *testing.T) {
 	}
 }
 
-func generateCertOrDie(notAfter time.Time) []byte {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
-	if err != nil {
-		panic(err)
-	}
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		NotBefore:    time.Now().Add(-time.Hour * 24 * 31),
-		NotAfter:     notAfter,
-	}
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, privateKey.Public(), privateKey)
-	if err != nil {
-		panic(err)
-	}
-	out := &bytes.Buffer{}
-	err = pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	if err != nil {
-		panic(err)
-	}
-	return out.Bytes()
-}
-
 func TestIsCertificateExpired(t *testing.T) {
 	for _, tc := range []struct {
 		csr         *certificates.CertificateSigningRequest
@@ -77,7 +54,7 @@ func TestIsCertificateExpired(t *testing.T) {
 		{
 			csr: &certificates.CertificateSigningRequest{
 				Status: certificates.CertificateSigningRequestStatus{
-					Certificate: generateCertOrDie(time.Now().Add(-time.Hour)),
+					Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", time.Now().Add(-time.Hour)),
 				},
 			},
 			gracePeriod: time.Minute * 45,
@@ -86,7 +63,7 @@ func TestIsCertificateExpired(t *testing.T) {
 		{
 			csr: &certificates.CertificateSigningRequest{
 				Status: certificates.CertificateSigningRequestStatus{
-					Certificate: generateCertOrDie(time.Now().Add(-time.Hour)),
+					Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", time.Now().Add(-time.Hour)),
 				},
 			},
 			gracePeriod: time.Minute * 61,
@@ -95,7 +72,7 @@ func TestIsCertificateExpired(t *testing.T) {
 		{
 			csr: &certificates.CertificateSigningRequest{
 				Status: certificates.CertificateSigningRequestStatus{
-					Certificate: generateCertOrDie(time.Now().Add(time.Hour)),
+					Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", time.Now().Add(time.Hour)),
 				},
 			},
 			gracePeriod: time.Minute * 1,
@@ -107,3 +84,218 @@ func TestIsCertificateExpired(t *testing.T) {
 		})
 	}
 }
+
+func TestPendingAndStuckApproved(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		csr           *certificates.CertificateSigningRequest
+		state         string
+		pending       bool
+		stuckApproved bool
+	}{
+		{
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour * 2)),
+				},
+			},
+			state:   StatePending,
+			pending: true,
+		},
+		{
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			state: StatePending,
+		},
+		{
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour * 2)),
+				},
+				Status: certificates.CertificateSigningRequestStatus{
+					Conditions: []certificates.CertificateSigningRequestCondition{
+						{
+							Type:           certificates.CertificateApproved,
+							LastUpdateTime: metav1.NewTime(now.Add(-time.Hour * 2)),
+						},
+					},
+				},
+			},
+			state:         StateApproved,
+			stuckApproved: true,
+		},
+		{
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour * 2)),
+				},
+				Status: certificates.CertificateSigningRequestStatus{
+					Conditions: []certificates.CertificateSigningRequestCondition{
+						{
+							Type:           certificates.CertificateApproved,
+							LastUpdateTime: metav1.NewTime(now.Add(-time.Hour * 2)),
+						},
+					},
+					Certificate: pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", now.Add(time.Hour)),
+				},
+			},
+			state: StateIssued,
+		},
+		{
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Hour * 2)),
+				},
+				Status: certificates.CertificateSigningRequestStatus{
+					Conditions: []certificates.CertificateSigningRequestCondition{
+						{
+							Type:           certificates.CertificateDenied,
+							LastUpdateTime: metav1.NewTime(now.Add(-time.Hour * 2)),
+						},
+					},
+				},
+			},
+			state: StateDenied,
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			assert.Equal(t, tc.state, CSRState(tc.csr))
+			assert.Equal(t, tc.pending, Pending.ShouldGC(tc.csr, time.Hour))
+			assert.Equal(t, tc.stuckApproved, StuckApproved.ShouldGC(tc.csr, time.Hour))
+		})
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	for _, tc := range []struct {
+		conf     *Config
+		csr      *certificates.CertificateSigningRequest
+		excluded bool
+	}{
+		{
+			conf: &Config{},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-csr-abc"},
+			},
+		},
+		{
+			conf: &Config{NamePrefix: "app-"},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-csr-abc"},
+			},
+			excluded: true,
+		},
+		{
+			conf: &Config{Requestors: []string{"system:nodes"}},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-csr-abc"},
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "system:node:node-0",
+					Groups:   []string{"system:nodes", "system:authenticated"},
+				},
+			},
+		},
+		{
+			conf: &Config{Requestors: []string{"system:serviceaccount:default:app"}},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-csr-abc"},
+				Spec: certificates.CertificateSigningRequestSpec{
+					Username: "system:node:node-0",
+					Groups:   []string{"system:nodes", "system:authenticated"},
+				},
+			},
+			excluded: true,
+		},
+		{
+			conf: &Config{},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Annotations: map[string]string{KubeCSRRetainAnnotation: "true"},
+				},
+			},
+			excluded: true,
+		},
+		{
+			conf: &Config{},
+			csr: &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Annotations: map[string]string{KubeCSRRetainAnnotation: "false"},
+				},
+			},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			p := &Purge{conf: tc.conf}
+			assert.Equal(t, tc.excluded, p.isExcluded(tc.csr))
+		})
+	}
+}
+
+func TestResumeIndex(t *testing.T) {
+	csrs := []certificates.CertificateSigningRequest{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "e"}},
+	}
+	for _, tc := range []struct {
+		lastName string
+		index    int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"b", 1},
+		{"c", 2},
+		{"e", 3},
+		{"f", 3},
+	} {
+		t.Run(tc.lastName, func(t *testing.T) {
+			assert.Equal(t, tc.index, resumeIndex(csrs, tc.lastName))
+		})
+	}
+}
+
+func TestWaitDeleteRate(t *testing.T) {
+	p := &Purge{conf: &Config{}}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.waitDeleteRate(context.Background()))
+	}
+	assert.True(t, time.Since(start) < time.Millisecond*100)
+
+	p.conf.DeleteQPS = 20
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.waitDeleteRate(context.Background()))
+	}
+	assert.True(t, time.Since(start) >= time.Millisecond*100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.conf.DeleteQPS = 0.1
+	assert.Equal(t, context.Canceled, p.waitDeleteRate(ctx))
+}
+
+func TestHealthz(t *testing.T) {
+	p := &Purge{conf: &Config{PollingPeriod: time.Minute}}
+	_, err := p.Healthz()
+	assert.Error(t, err)
+
+	p.setNextRun(time.Now().Add(time.Minute))
+	_, err = p.Healthz()
+	assert.NoError(t, err)
+
+	// the run started long ago
+	p.setNextRun(time.Now().Add(-time.Minute * 3))
+	_, err = p.Healthz()
+	assert.Error(t, err)
+
+	// but it still deletes csr
+	p.setProgress()
+	_, err = p.Healthz()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,218 @@
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+)
+
+const (
+	// ReportFormatTable writes the report as an aligned table
+	ReportFormatTable = "table"
+	// ReportFormatJSON writes the report as a JSON array
+	ReportFormatJSON = "json"
+)
+
+// Candidate is a csr matched by a predicate, deleted by the GC once the grace period is elapsed
+type Candidate struct {
+	Name            string        `json:"name"`
+	Predicate       string        `json:"predicate"`
+	Requester       string        `json:"requester"`
+	Age             time.Duration `json:"-"`
+	GracePeriodLeft time.Duration `json:"-"`
+	Delete          bool          `json:"delete"`
+}
+
+// MarshalJSON writes the durations in seconds
+func (c *Candidate) MarshalJSON() ([]byte, error) {
+	type candidate Candidate
+	return json.Marshal(&struct {
+		*candidate
+		AgeSeconds             float64 `json:"ageSeconds"`
+		GracePeriodLeftSeconds float64 `json:"gracePeriodLeftSeconds"`
+	}{
+		candidate:              (*candidate)(c),
+		AgeSeconds:             c.Age.Round(time.Second).Seconds(),
+		GracePeriodLeftSeconds: c.GracePeriodLeft.Round(time.Second).Seconds(),
+	})
+}
+
+// newCandidates returns a candidate for each predicate matching the csr, in the order of the predicates
+func (p *Purge) newCandidates(csr *certificates.CertificateSigningRequest, now time.Time) []*Candidate {
+	var candidates []*Candidate
+	for _, predicate := range p.conf.allPredicates() {
+		left, ok := predicate.GracePeriodLeft(csr, p.conf.GracePeriod, now)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, &Candidate{
+			Name:            csr.Name,
+			Predicate:       predicate.Name,
+			Requester:       csr.Spec.Username,
+			Age:             now.Sub(csr.CreationTimestamp.Time),
+			GracePeriodLeft: left,
+			Delete:          left <= 0,
+		})
+	}
+	return candidates
+}
+
+// firstCandidate returns the first candidate with an elapsed grace period,
+// or the one with the shortest grace period left, nil without candidates
+func firstCandidate(candidates []*Candidate) *Candidate {
+	var c *Candidate
+	for _, candidate := range candidates {
+		if candidate.Delete {
+			return candidate
+		}
+		if c == nil || candidate.GracePeriodLeft < c.GracePeriodLeft {
+			c = candidate
+		}
+	}
+	return c
+}
+
+// newCandidate returns the first predicate matching the csr with an elapsed grace period,
+// or the matching predicate with the shortest grace period left, nil if none matches
+func (p *Purge) newCandidate(csr *certificates.CertificateSigningRequest, now time.Time) *Candidate {
+	return firstCandidate(p.newCandidates(csr, now))
+}
+
+// Evaluator evaluates the csr like the GC without deleting them:
+// the exclusions, the predicates with their grace period and the KeepLast history of the Config
+type Evaluator struct {
+	p          *Purge
+	now        time.Time
+	candidates map[string]*Candidate
+	matches    map[string][]*Candidate
+	history    map[string][]historyEntry
+	keptLast   bool
+}
+
+// NewEvaluator creates a new Evaluator of the csr at the given time
+func NewEvaluator(conf *Config, now time.Time) *Evaluator {
+	return &Evaluator{
+		p:          &Purge{conf: conf},
+		now:        now,
+		candidates: make(map[string]*Candidate),
+		matches:    make(map[string][]*Candidate),
+		history:    make(map[string][]historyEntry),
+	}
+}
+
+// Add evaluates a page of csr, the KeepLast history is complete once all the pages are added
+func (e *Evaluator) Add(csrs []certificates.CertificateSigningRequest) {
+	for i := range csrs {
+		csr := &csrs[i]
+		if e.p.isExcluded(csr) {
+			e.p.addHistory(e.history, csr, true)
+			continue
+		}
+		matches := e.p.newCandidates(csr, e.now)
+		c := firstCandidate(matches)
+		if c != nil {
+			e.candidates[c.Name] = c
+			e.matches[c.Name] = matches
+		}
+		if c == nil || !c.Delete {
+			e.p.addHistory(e.history, csr, false)
+		}
+	}
+}
+
+// keepLast adds the candidates beyond the KeepLast history, once all the pages are added
+func (e *Evaluator) keepLast() {
+	if e.keptLast {
+		return
+	}
+	e.keptLast = true
+	beyond := e.p.beyondGroups(e.history)
+	for i := range beyond {
+		c := e.p.keepLastCandidate(&beyond[i], e.now)
+		e.matches[c.Name] = append(e.matches[c.Name], c)
+		existing, ok := e.candidates[c.Name]
+		if !ok || c.GracePeriodLeft < existing.GracePeriodLeft {
+			e.candidates[c.Name] = c
+		}
+	}
+}
+
+// Candidates returns the candidate deleted first of each added csr by name, with the ones beyond the KeepLast history
+func (e *Evaluator) Candidates() map[string]*Candidate {
+	e.keepLast()
+	return e.candidates
+}
+
+// Matches returns all the candidates of each added csr by name: one per matching predicate
+// with its own grace period left, and the one beyond the KeepLast history
+func (e *Evaluator) Matches() map[string][]*Candidate {
+	e.keepLast()
+	return e.matches
+}
+
+// DryRun returns the csr matched by the predicates or beyond the KeepLast history without deleting them
+func (p *Purge) DryRun(ctx context.Context) ([]*Candidate, error) {
+	var evaluator *Evaluator
+	total := 0
+	reset := func() {
+		evaluator, total = NewEvaluator(p.conf, time.Now()), 0
+	}
+	reset()
+	err := p.listPages(ctx, "", reset, func(csrList *certificates.CertificateSigningRequestList) (bool, error) {
+		total += len(csrList.Items)
+		evaluator.Add(csrList.Items)
+		return true, ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	candidates := evaluator.Candidates()
+	report := make([]*Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		report = append(report, c)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].GracePeriodLeft == report[j].GracePeriodLeft {
+			return report[i].Name < report[j].Name
+		}
+		return report[i].GracePeriodLeft < report[j].GracePeriodLeft
+	})
+	glog.V(0).Infof("Dry run: %d/%d csr matched", len(report), total)
+	return report, nil
+}
+
+// WriteReport writes the candidates with the given format
+func WriteReport(w io.Writer, candidates []*Candidate, format string) error {
+	switch format {
+	case ReportFormatJSON:
+		if candidates == nil {
+			candidates = []*Candidate{}
+		}
+		b, err := json.MarshalIndent(candidates, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+
+	case ReportFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tPREDICATE\tREQUESTER\tAGE\tGRACE PERIOD LEFT\tDELETE")
+		for _, c := range candidates {
+			left := "0s"
+			if c.GracePeriodLeft > 0 {
+				left = durationFormat(c.GracePeriodLeft)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\n", c.Name, c.Predicate, c.Requester, durationFormat(c.Age), left, c.Delete)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("invalid report format %q, must be one of %s, %s", format, ReportFormatTable, ReportFormatJSON)
+}
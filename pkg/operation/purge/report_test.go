@@ -0,0 +1,96 @@
+package purge
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+func TestNewCandidate(t *testing.T) {
+	now := time.Now()
+	p := &Purge{
+		conf: NewPurgeConfigWithPredicates(time.Hour, ConditionDenied, CertificateExpired),
+	}
+	newCSR := func(certificate []byte, deniedSince time.Duration) *certificates.CertificateSigningRequest {
+		csr := &certificates.CertificateSigningRequest{
+			ObjectMeta: v1.ObjectMeta{
+				Name:              "csr",
+				CreationTimestamp: v1.NewTime(now.Add(-time.Hour * 24)),
+			},
+			Spec: certificates.CertificateSigningRequestSpec{
+				Username: "system:serviceaccount:default:app",
+			},
+			Status: certificates.CertificateSigningRequestStatus{
+				Certificate: certificate,
+			},
+		}
+		if deniedSince > 0 {
+			csr.Status.Conditions = []certificates.CertificateSigningRequestCondition{
+				{
+					Type:           certificates.CertificateDenied,
+					LastUpdateTime: v1.NewTime(now.Add(-deniedSince)),
+				},
+			}
+		}
+		return csr
+	}
+
+	// no predicate
+	assert.Nil(t, p.newCandidate(newCSR(pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", now.Add(time.Hour)), 0), now))
+
+	// denied in grace period
+	c := p.newCandidate(newCSR(nil, time.Minute*15), now)
+	require.NotNil(t, c)
+	assert.Equal(t, "denied", c.Predicate)
+	assert.Equal(t, time.Minute*45, c.GracePeriodLeft)
+	assert.Equal(t, time.Hour*24, c.Age)
+	assert.Equal(t, "system:serviceaccount:default:app", c.Requester)
+	assert.False(t, c.Delete)
+
+	// expired after the grace period
+	c = p.newCandidate(newCSR(pemtest.GenerateCertOrDie(pemtest.GenerateKeyOrDie(), "", now.Add(-time.Hour*2)), time.Minute*15), now)
+	require.NotNil(t, c)
+	assert.Equal(t, "expired", c.Predicate)
+	assert.True(t, c.Delete)
+
+	// the ShouldGC functions of the previous releases
+	p.conf = NewPurgeConfig(time.Hour, IsConditionDenied)
+	assert.Nil(t, p.newCandidate(newCSR(nil, time.Minute*15), now))
+	c = p.newCandidate(newCSR(nil, time.Hour*2), now)
+	require.NotNil(t, c)
+	assert.Equal(t, ShouldGCReason, c.Predicate)
+	assert.True(t, c.Delete)
+}
+
+func TestWriteReport(t *testing.T) {
+	candidates := []*Candidate{
+		{
+			Name:            "csr",
+			Predicate:       "fetched",
+			Requester:       "admin",
+			Age:             time.Hour * 25,
+			GracePeriodLeft: -time.Minute,
+			Delete:          true,
+		},
+	}
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteReport(out, candidates, ReportFormatTable))
+	assert.Equal(t, "NAME  PREDICATE  REQUESTER  AGE                GRACE PERIOD LEFT  DELETE\ncsr   fetched    admin      1 days and 1h0m0s  0s                 true\n", out.String())
+
+	out.Reset()
+	require.NoError(t, WriteReport(out, candidates, ReportFormatJSON))
+	assert.JSONEq(t, `[{"name":"csr","predicate":"fetched","requester":"admin","delete":true,"ageSeconds":90000,"gracePeriodLeftSeconds":-60}]`, out.String())
+
+	out.Reset()
+	require.NoError(t, WriteReport(out, nil, ReportFormatJSON))
+	assert.Equal(t, "[]\n", out.String())
+
+	assert.Error(t, WriteReport(out, candidates, "yaml"))
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"time"
@@ -34,8 +35,13 @@ type serviceToQuery struct {
 	ok  bool
 }
 
-// NewQuery creates a new Query
+// NewQuery creates a new Query, pass kubeConfigPath == "" to use the InCluster config
 func NewQuery(kubeConfigPath string, svcToQuery []string, conf *Config) (*Query, error) {
+	return NewQueryFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath}, svcToQuery, conf)
+}
+
+// NewQueryFromConfig is the NewQuery with the context, the impersonation and the tuning of the Kubernetes client
+func NewQueryFromConfig(kubeConfig *kubeclient.Config, svcToQuery []string, conf *Config) (*Query, error) {
 	if conf.PollingInterval == 0 {
 		err := fmt.Errorf("invalid value for PollingInterval: %s", conf.PollingInterval.String())
 		glog.Errorf("Cannot use the provided config: %v", err)
@@ -46,12 +52,12 @@ func NewQuery(kubeConfigPath string, svcToQuery []string, conf *Config) (*Query,
 		glog.Errorf("Cannot use the provided config: %v", err)
 		return nil, err
 	}
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
 	currentNamespace := defaultNamespace
-	if kubeConfigPath == "" {
+	if kubeConfig.InCluster() {
 		b, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 		if err != nil {
 			glog.Warningf("Unexpected error during namespace detection: %v, fallback to %q", err, defaultNamespace)
@@ -86,8 +92,8 @@ func NewQuery(kubeConfigPath string, svcToQuery []string, conf *Config) (*Query,
 }
 
 // GetKubernetesServicesSubjectAlternativeNames query the kube-apiserver to grab all
-// potentials SAN in each service given to query
-func (q *Query) GetKubernetesServicesSubjectAlternativeNames() ([]string, error) {
+// potentials SAN in each service given to query, returns when the context is done
+func (q *Query) GetKubernetesServicesSubjectAlternativeNames(ctx context.Context) ([]string, error) {
 	ticker := time.NewTicker(q.conf.PollingInterval)
 	defer ticker.Stop()
 
@@ -97,6 +103,10 @@ func (q *Query) GetKubernetesServicesSubjectAlternativeNames() ([]string, error)
 	var sans []string
 	for {
 		select {
+		case <-ctx.Done():
+			glog.Infof("Stop querying kube-services: %v", ctx.Err())
+			return nil, ctx.Err()
+
 		case <-ticker.C:
 			for _, elt := range q.servicesToQuery {
 				if elt.ok {
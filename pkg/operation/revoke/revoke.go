@@ -0,0 +1,122 @@
+package revoke
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+)
+
+const (
+	// KubeCSRRevokedTimeAnnotation is the date when the annotated csr has been revoked
+	// Kubernetes cannot revoke a certificate, the holders of the csr are expected to rotate their private key
+	KubeCSRRevokedTimeAnnotation = fetch.KubeCSRFetchedAnnotationPrefix + "revokedTime"
+	// KubeCSRRevokedReasonAnnotation is the reason of the revocation
+	KubeCSRRevokedReasonAnnotation = fetch.KubeCSRFetchedAnnotationPrefix + "revokedReason"
+)
+
+// Config of the Revoke
+type Config struct {
+	Reason string
+}
+
+// Revoke state
+type Revoke struct {
+	conf       *Config
+	kubeClient *kubeclient.KubeClient
+}
+
+// NewRevoker creates a new Revoke
+func NewRevoker(kubeConfig *kubeclient.Config, conf *Config) (*Revoke, error) {
+	if conf.Reason == "" {
+		err := fmt.Errorf("empty revocation reason")
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Revoke{
+		conf:       conf,
+		kubeClient: k,
+	}, nil
+}
+
+// IsRevoked returns if the csr is annotated as revoked and the reason of the revocation
+func IsRevoked(csr *certificates.CertificateSigningRequest) (string, bool) {
+	if csr.Annotations == nil {
+		return "", false
+	}
+	_, ok := csr.Annotations[KubeCSRRevokedTimeAnnotation]
+	if !ok {
+		return "", false
+	}
+	return csr.Annotations[KubeCSRRevokedReasonAnnotation], true
+}
+
+// annotate marks the csr as revoked, returns false if the csr was already revoked
+func annotate(csr *certificates.CertificateSigningRequest, reason string, now time.Time) bool {
+	previousReason, revoked := IsRevoked(csr)
+	if revoked {
+		glog.V(0).Infof("csr/%s uid: %s already revoked since %s: %q", csr.Name, csr.UID, csr.Annotations[KubeCSRRevokedTimeAnnotation], previousReason)
+		return false
+	}
+	if csr.Annotations == nil {
+		csr.Annotations = make(map[string]string)
+	}
+	csr.Annotations[KubeCSRRevokedTimeAnnotation] = now.UTC().Format(fetch.KubeCsrFetchedAnnotationDateFormat)
+	csr.Annotations[KubeCSRRevokedReasonAnnotation] = reason
+	return true
+}
+
+func (r *Revoke) revoke(csr *certificates.CertificateSigningRequest) error {
+	if !annotate(csr, r.conf.Reason, time.Now()) {
+		return nil
+	}
+	_, err := r.kubeClient.GetCertificateClient().CertificateSigningRequests().Update(csr)
+	if err != nil {
+		glog.Errorf("Cannot annotate csr/%s as revoked: %v", csr.Name, err)
+		return err
+	}
+	glog.V(0).Infof("Successfully revoked csr/%s uid: %s: %q", csr.Name, csr.UID, r.conf.Reason)
+	return nil
+}
+
+// Revoke annotates the given csr as revoked
+func (r *Revoke) Revoke(csrName string) error {
+	csr, err := r.kubeClient.GetCertificateClient().CertificateSigningRequests().Get(csrName, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Cannot get csr/%s: %v", csrName, err)
+		return err
+	}
+	return r.revoke(csr)
+}
+
+// RevokeSelector annotates as revoked all the csr matching the label selector, returns the number of matching csr
+func (r *Revoke) RevokeSelector(selector string) (int, error) {
+	csrList, err := r.kubeClient.GetCertificateClient().CertificateSigningRequests().List(metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		glog.Errorf("Cannot list csr with selector %q: %v", selector, err)
+		return 0, err
+	}
+	glog.V(0).Infof("Revoking %d csr matching the selector %q", len(csrList.Items), selector)
+	var errs int
+	for i := range csrList.Items {
+		err = r.revoke(&csrList.Items[i])
+		if err != nil {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return len(csrList.Items), fmt.Errorf("failed to revoke %d/%d csr", errs, len(csrList.Items))
+	}
+	return len(csrList.Items), nil
+}
@@ -0,0 +1,34 @@
+package revoke
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certificates "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnnotate(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "csr",
+		},
+	}
+	_, revoked := IsRevoked(csr)
+	assert.False(t, revoked)
+
+	assert.True(t, annotate(csr, "key leaked", now))
+	reason, revoked := IsRevoked(csr)
+	assert.True(t, revoked)
+	assert.Equal(t, "key leaked", reason)
+	assert.Equal(t, "2018-01-01T00:00:00Z", csr.Annotations[KubeCSRRevokedTimeAnnotation])
+
+	// the first revocation is kept
+	assert.False(t, annotate(csr, "other", now.Add(time.Hour)))
+	reason, revoked = IsRevoked(csr)
+	assert.True(t, revoked)
+	assert.Equal(t, "key leaked", reason)
+	assert.Equal(t, "2018-01-01T00:00:00Z", csr.Annotations[KubeCSRRevokedTimeAnnotation])
+}
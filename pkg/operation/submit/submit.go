@@ -25,9 +25,14 @@ type Submit struct {
 	kubeClient *kubeclient.KubeClient
 }
 
-// NewSubmitter is a Kubernetes client to create/apply csr
+// NewSubmitter is a Kubernetes client to create/apply csr, pass kubeConfigPath == "" to use the InCluster config
 func NewSubmitter(kubeConfigPath string, conf *Config) (*Submit, error) {
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	return NewSubmitterFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath}, conf)
+}
+
+// NewSubmitterFromConfig is the NewSubmitter with the context, the impersonation and the tuning of the Kubernetes client
+func NewSubmitterFromConfig(kubeConfig *kubeclient.Config, conf *Config) (*Submit, error) {
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
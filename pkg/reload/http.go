@@ -0,0 +1,81 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/golang/glog"
+)
+
+// HTTP calls a reload endpoint listening on localhost
+type HTTP struct {
+	url    string
+	method string
+	client *http.Client
+}
+
+// NewHTTP creates a new HTTP, the url must target a loopback address
+func NewHTTP(rawURL, method string) (*HTTP, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		glog.Errorf("Cannot parse reload url %q: %v", rawURL, err)
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("unsupported scheme for reload url %q", rawURL)
+		glog.Errorf("Cannot use the reload url: %v", err)
+		return nil, err
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		err = fmt.Errorf("reload url %q must target localhost", rawURL)
+		glog.Errorf("Cannot use the reload url: %v", err)
+		return nil, err
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+	return &HTTP{
+		url:    u.String(),
+		method: method,
+		client: &http.Client{},
+	}, nil
+}
+
+// Reload calls the endpoint, any non 2xx status code is an error
+func (h *HTTP) Reload(ctx context.Context) error {
+	req, err := http.NewRequest(h.method, h.url, nil)
+	if err != nil {
+		glog.Errorf("Cannot create reload request: %v", err)
+		return err
+	}
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		glog.Errorf("Unexpected error during %s %s: %v", h.method, h.url, err)
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = fmt.Errorf("%s %s returns %s", h.method, h.url, resp.Status)
+		glog.Errorf("Unexpected status code: %v", err)
+		return err
+	}
+	glog.V(0).Infof("Successfully called %s %s: %s", h.method, h.url, resp.Status)
+	return nil
+}
+
+// Action returns http
+func (h *HTTP) Action() string {
+	return "http"
+}
+
+func (h *HTTP) String() string {
+	return fmt.Sprintf("%s %s", h.method, h.url)
+}
@@ -0,0 +1,201 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+const procPath = "/proc"
+
+// Reloader notifies a process consuming the certificate to reload it
+type Reloader interface {
+	// Reload triggers the reload, returns when the context is done
+	Reload(ctx context.Context) error
+	// Action is the kind of reload, used as metric label
+	Action() string
+	String() string
+}
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ParseSignal returns the signal from its name like SIGHUP, HUP or its number like 1
+func ParseSignal(s string) (syscall.Signal, error) {
+	n, err := strconv.Atoi(s)
+	if err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid signal number: %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal: %q", s)
+	}
+	return sig, nil
+}
+
+func sendSignal(pid int, sig syscall.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		glog.Errorf("Cannot find process %d: %v", pid, err)
+		return err
+	}
+	err = p.Signal(sig)
+	if err != nil {
+		glog.Errorf("Cannot send signal %s to process %d: %v", sig.String(), pid, err)
+		return err
+	}
+	glog.V(0).Infof("Sent signal %s to process %d", sig.String(), pid)
+	return nil
+}
+
+// PidFile sends a signal to the process referenced in a pid file
+type PidFile struct {
+	pidFile string
+	signal  syscall.Signal
+}
+
+// NewPidFile creates a new PidFile
+func NewPidFile(pidFile string, sig syscall.Signal) *PidFile {
+	return &PidFile{
+		pidFile: pidFile,
+		signal:  sig,
+	}
+}
+
+// Reload sends the signal to the process
+func (p *PidFile) Reload(ctx context.Context) error {
+	b, err := ioutil.ReadFile(p.pidFile)
+	if err != nil {
+		glog.Errorf("Cannot read pid file: %v", err)
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		glog.Errorf("Cannot parse pid file %s: %v", p.pidFile, err)
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sendSignal(pid, p.signal)
+}
+
+// Action returns pidfile
+func (p *PidFile) Action() string {
+	return "pidfile"
+}
+
+func (p *PidFile) String() string {
+	return fmt.Sprintf("signal %s to pid file %s", p.signal.String(), p.pidFile)
+}
+
+// ProcessName sends a signal to the processes matching a name,
+// the processes must be visible in the /proc of the current process namespace
+type ProcessName struct {
+	name   string
+	signal syscall.Signal
+}
+
+// NewProcessName creates a new ProcessName
+func NewProcessName(name string, sig syscall.Signal) *ProcessName {
+	return &ProcessName{
+		name:   name,
+		signal: sig,
+	}
+}
+
+// matchProcess returns if the process of the given /proc/<pid> directory is named name,
+// the comm is truncated by the kernel so the first element of the cmdline is also compared
+func matchProcess(procPidPath, name string) bool {
+	b, err := ioutil.ReadFile(path.Join(procPidPath, "comm"))
+	if err != nil {
+		return false
+	}
+	if strings.TrimSpace(string(b)) == name {
+		return true
+	}
+	b, err = ioutil.ReadFile(path.Join(procPidPath, "cmdline"))
+	if err != nil || len(b) == 0 {
+		return false
+	}
+	argv0 := strings.SplitN(string(b), "\x00", 2)[0]
+	return path.Base(argv0) == name
+}
+
+// findPids returns the pid of the processes matching the name, excluding the current one
+func (p *ProcessName) findPids() ([]int, error) {
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		glog.Errorf("Cannot list processes in %s: %v", procPath, err)
+		return nil, err
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		if matchProcess(path.Join(procPath, e.Name()), p.name) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// Reload sends the signal to every matching process
+func (p *ProcessName) Reload(ctx context.Context) error {
+	pids, err := p.findPids()
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		err = fmt.Errorf("no process named %q", p.name)
+		glog.Errorf("Cannot reload: %v", err)
+		return err
+	}
+	var errs []string
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = sendSignal(pid, p.signal)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if errs == nil {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, ", "))
+}
+
+// Action returns process
+func (p *ProcessName) Action() string {
+	return "process"
+}
+
+func (p *ProcessName) String() string {
+	return fmt.Sprintf("signal %s to process %q", p.signal.String(), p.name)
+}
@@ -0,0 +1,128 @@
+package reload
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		signal syscall.Signal
+		err    bool
+	}{
+		{
+			input:  "SIGHUP",
+			signal: syscall.SIGHUP,
+		},
+		{
+			input:  "hup",
+			signal: syscall.SIGHUP,
+		},
+		{
+			input:  "USR2",
+			signal: syscall.SIGUSR2,
+		},
+		{
+			input:  "10",
+			signal: syscall.Signal(10),
+		},
+		{
+			input: "0",
+			err:   true,
+		},
+		{
+			input: "SIGFOO",
+			err:   true,
+		},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			sig, err := ParseSignal(tc.input)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.signal, sig)
+		})
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	pidFile := path.Join(tempDir, "pid")
+	p := NewPidFile(pidFile, syscall.Signal(0))
+	assert.Error(t, p.Reload(context.Background()))
+
+	require.NoError(t, ioutil.WriteFile(pidFile, []byte("foo\n"), 0600))
+	assert.Error(t, p.Reload(context.Background()))
+
+	// signal 0 only checks the existence of the process
+	require.NoError(t, ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600))
+	assert.NoError(t, p.Reload(context.Background()))
+}
+
+func TestNewHTTP(t *testing.T) {
+	for _, tc := range []struct {
+		url string
+		err bool
+	}{
+		{
+			url: "http://127.0.0.1:8080/reload",
+		},
+		{
+			url: "http://localhost/reload",
+		},
+		{
+			url: "https://[::1]:8443/-/reload",
+		},
+		{
+			url: "http://example.com/reload",
+			err: true,
+		},
+		{
+			url: "http://10.0.0.1/reload",
+			err: true,
+		},
+		{
+			url: "unix:///var/run/app.sock",
+			err: true,
+		},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			_, err := NewHTTP(tc.url, "")
+			assert.Equal(t, tc.err, err != nil)
+		})
+	}
+}
+
+func TestHTTPReload(t *testing.T) {
+	status := http.StatusOK
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	h, err := NewHTTP(ts.URL+"/reload", "")
+	require.NoError(t, err)
+	assert.NoError(t, h.Reload(context.Background()))
+	assert.Equal(t, http.MethodPost, method)
+
+	status = http.StatusInternalServerError
+	assert.Error(t, h.Reload(context.Background()))
+}
@@ -0,0 +1,51 @@
+package renew
+
+import (
+	"time"
+)
+
+// minRetryDelay is the floor of the retry delay when the certificate is about to expire
+const minRetryDelay = time.Second
+
+// retryDelay returns the delay before retrying a failed renew:
+// an exponential backoff from RenewRetryDelay capped by RenewRetryMaxDelay,
+// shortened to the half of the time left before the certificate expiration
+func (r *Renew) retryDelay(now time.Time) time.Duration {
+	delay := r.conf.RenewRetryDelay
+	for i := 1; i < r.consecutiveErrors && delay < r.conf.RenewRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.conf.RenewRetryMaxDelay {
+		delay = r.conf.RenewRetryMaxDelay
+	}
+	if r.notAfter.IsZero() {
+		return delay
+	}
+	timeLeft := r.notAfter.Sub(now)
+	if timeLeft <= 0 {
+		return delay
+	}
+	if delay > timeLeft/2 {
+		delay = timeLeft / 2
+	}
+	if delay < minRetryDelay {
+		delay = minRetryDelay
+	}
+	return delay
+}
+
+// isExpired returns if the last known certificate is expired
+func (r *Renew) isExpired(now time.Time) bool {
+	return !r.notAfter.IsZero() && now.After(r.notAfter)
+}
+
+// resetTimer stops, drains and resets the timer to the given duration
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,72 @@
+package renew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		consecutiveErrors int
+		notAfter          time.Time
+		delay             time.Duration
+	}{
+		{
+			consecutiveErrors: 1,
+			delay:             time.Second * 10,
+		},
+		{
+			consecutiveErrors: 3,
+			delay:             time.Second * 40,
+		},
+		{
+			consecutiveErrors: 100,
+			delay:             time.Minute * 5,
+		},
+		{
+			consecutiveErrors: 100,
+			notAfter:          now.Add(time.Hour),
+			delay:             time.Minute * 5,
+		},
+		{
+			consecutiveErrors: 100,
+			notAfter:          now.Add(time.Minute),
+			delay:             time.Second * 30,
+		},
+		{
+			consecutiveErrors: 1,
+			notAfter:          now.Add(time.Second),
+			delay:             time.Second,
+		},
+		{
+			consecutiveErrors: 2,
+			notAfter:          now.Add(-time.Hour),
+			delay:             time.Second * 20,
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			r := &Renew{
+				conf: &Config{
+					RenewRetryDelay:    time.Second * 10,
+					RenewRetryMaxDelay: time.Minute * 5,
+				},
+				consecutiveErrors: tc.consecutiveErrors,
+				notAfter:          tc.notAfter,
+			}
+			assert.Equal(t, tc.delay, r.retryDelay(now))
+		})
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+	r := &Renew{}
+	assert.False(t, r.isExpired(now))
+	r.notAfter = now.Add(time.Minute)
+	assert.False(t, r.isExpired(now))
+	r.notAfter = now.Add(-time.Minute)
+	assert.True(t, r.isExpired(now))
+}
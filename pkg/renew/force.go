@@ -0,0 +1,85 @@
+package renew
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/api"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+const forceRenewPath = "/renew"
+
+// ForceRenew asks the renew loop for an immediate renew bypassing the renew threshold,
+// returns the result of the renew or when the context is done
+func (r *Renew) ForceRenew(ctx context.Context) error {
+	resultCh := make(chan error, 1)
+	select {
+	case r.forceRenewCh <- resultCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-resultCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// forceRenew runs in the renew loop to serve the ForceRenew, at most once per ForceRenewMinInterval
+func (r *Renew) forceRenew(ctx context.Context, renewedCh chan<- struct{}) error {
+	now := time.Now()
+	if !r.lastForceRenew.IsZero() && now.Sub(r.lastForceRenew) < r.conf.ForceRenewMinInterval {
+		err := fmt.Errorf("the last forced renew was %s ago, retry in %s", now.Sub(r.lastForceRenew).Round(time.Second), r.lastForceRenew.Add(r.conf.ForceRenewMinInterval).Sub(now).Round(time.Second))
+		glog.Warningf("Rejecting the forced renew: %v", err)
+		return err
+	}
+	r.lastForceRenew = now
+	glog.V(0).Infof("Forcing the renew of the certificate %s", r.conf.Operation.Fetch.Conf.CertificateABSPath)
+	r.promForceRenewCount.Inc()
+	_, err := r.processRenew(ctx, true)
+	if err != nil {
+		glog.Errorf("Failed to force the renew: %v", err)
+		r.promForceRenewErrorCount.Inc()
+		r.promRenewErrorCount.Inc()
+		return err
+	}
+	r.consecutiveErrors = 0
+	r.promConsecutiveErrors.Set(0)
+	select {
+	case renewedCh <- struct{}{}:
+	default:
+		glog.V(1).Infof("Renew already notified")
+	}
+	return nil
+}
+
+// forceRenewRoute serves the ForceRenew over http
+func (r *Renew) forceRenewRoute() *api.Route {
+	return &api.Route{
+		Path:   forceRenewPath,
+		Method: http.MethodPost,
+		Handler: api.JSONHandler(func(req *http.Request) (map[string]string, error) {
+			err := r.ForceRenew(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			details := map[string]string{
+				"csr": r.conf.Operation.SourceConfig.Name,
+			}
+			cert, err := pemio.ReadCertificate(r.conf.Operation.Fetch.Conf.CertificateABSPath)
+			if err != nil {
+				glog.Errorf("Cannot read the renewed certificate: %v", err)
+				return details, nil
+			}
+			details["serial"] = cert.SerialNumber.String()
+			details["notAfter"] = cert.NotAfter.Format(time.RFC3339)
+			return details, nil
+		}),
+	}
+}
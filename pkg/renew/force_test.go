@@ -0,0 +1,33 @@
+package renew
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceRenewContextDone(t *testing.T) {
+	r := &Renew{
+		forceRenewCh: make(chan chan error),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	// no renew loop is running
+	err := r.ForceRenew(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestForceRenewMinInterval(t *testing.T) {
+	r := &Renew{
+		conf: &Config{
+			ForceRenewMinInterval: time.Minute,
+		},
+		lastForceRenew: time.Now().Add(-time.Second * 10),
+	}
+	// rejected before any renew
+	err := r.forceRenew(context.Background(), nil)
+	assert.Error(t, err)
+}
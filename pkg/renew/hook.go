@@ -0,0 +1,167 @@
+package renew
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+const (
+	// HookPolicyFail reports the error of the hook: the pre-renew hook aborts the renew,
+	// the post-renew hook counts as a renew error and fails the exit on renew
+	HookPolicyFail = "fail"
+	// HookPolicyRetry retries the hook before applying the HookPolicyFail
+	HookPolicyRetry = "retry"
+	// HookPolicyIgnore only logs and counts the error of the hook
+	HookPolicyIgnore = "ignore"
+
+	preRenewHook  = "pre-renew"
+	postRenewHook = "post-renew"
+
+	hookRetryDelay = time.Second
+
+	// DefaultHookTimeout is the timeout of the deprecated RenewCommand
+	DefaultHookTimeout = time.Minute
+)
+
+// Hook is a command executed with /bin/sh around a renew
+type Hook struct {
+	Command string
+	Timeout time.Duration
+	Policy  string
+	Retries int
+}
+
+func (h *Hook) validate() error {
+	if h.Timeout <= 0 {
+		return fmt.Errorf("non-positive timeout for the hook %q: %s", h.Command, h.Timeout)
+	}
+	switch h.Policy {
+	case HookPolicyFail, HookPolicyIgnore:
+		return nil
+	case HookPolicyRetry:
+		if h.Retries <= 0 {
+			return fmt.Errorf("non-positive retries for the hook %q: %d", h.Command, h.Retries)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid policy for the hook %q: %q, must be one of %s, %s, %s", h.Command, h.Policy, HookPolicyFail, HookPolicyRetry, HookPolicyIgnore)
+}
+
+// renewCommandHook returns the PostRenewHook of the deprecated RenewCommand, nil without command
+func renewCommandHook(command string) *Hook {
+	if command == "" {
+		return nil
+	}
+	return &Hook{
+		Command: command,
+		Timeout: DefaultHookTimeout,
+		Policy:  HookPolicyFail,
+	}
+}
+
+// hookEnv returns the environment variables describing the files and the certificate to the hooks
+func (r *Renew) hookEnv(hookName string) []string {
+	certABSPath := r.conf.Operation.Fetch.Conf.CertificateABSPath
+	env := []string{
+		"KUBE_CSR_HOOK=" + hookName,
+		"KUBE_CSR_COMMON_NAME=" + r.conf.Operation.SourceConfig.CommonName,
+		"KUBE_CSR_CSR_NAME=" + r.conf.Operation.SourceConfig.Name,
+		"KUBE_CSR_PRIVATE_KEY_FILE=" + r.conf.Operation.SourceConfig.PrivateKeyABSPath,
+		"KUBE_CSR_CSR_FILE=" + r.conf.Operation.SourceConfig.CSRABSPath,
+		"KUBE_CSR_CERTIFICATE_FILE=" + certABSPath,
+	}
+	b, err := ioutil.ReadFile(certABSPath)
+	if err != nil {
+		glog.V(1).Infof("No certificate details for the %s hook: %v", hookName, err)
+		return env
+	}
+	cert, err := pemio.ParseCertificate(b)
+	if err != nil {
+		glog.V(1).Infof("No certificate details for the %s hook: %v", hookName, err)
+		return env
+	}
+	return append(env,
+		"KUBE_CSR_SERIAL="+cert.SerialNumber.String(),
+		"KUBE_CSR_NOT_BEFORE="+cert.NotBefore.UTC().Format(time.RFC3339),
+		"KUBE_CSR_NOT_AFTER="+cert.NotAfter.UTC().Format(time.RFC3339),
+		"KUBE_CSR_SANS="+strings.Join(pemio.SubjectAlternativeNames(cert.DNSNames, cert.IPAddresses), ","),
+	)
+}
+
+// execHook runs the hook in its own process group to kill all its processes on timeout
+func (r *Renew) execHook(ctx context.Context, hookName string, hook *Hook) error {
+	hookCtx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	output := &bytes.Buffer{}
+	c := exec.Command("/bin/sh", "-c", hook.Command)
+	c.Env = append(os.Environ(), r.hookEnv(hookName)...)
+	c.Stdout, c.Stderr = output, output
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := c.Start()
+	if err != nil {
+		glog.Errorf("Cannot start the %s hook: %v", hookName, err)
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-hookCtx.Done():
+		syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = hookCtx.Err()
+		if err == context.DeadlineExceeded {
+			err = fmt.Errorf("timeout of %s reached by the %s hook", hook.Timeout, hookName)
+		}
+	}
+	glog.V(0).Infof("Hook %s command %q output:\n%s", hookName, hook.Command, output.String())
+	return err
+}
+
+// runHook executes the hook according to its policy, returns an error only with the HookPolicyFail and the HookPolicyRetry
+func (r *Renew) runHook(ctx context.Context, hookName string, hook *Hook) error {
+	if hook == nil || hook.Command == "" {
+		return nil
+	}
+	attempts := 1
+	if hook.Policy == HookPolicyRetry {
+		attempts += hook.Retries
+	}
+	var err error
+	for i := 1; i <= attempts; i++ {
+		err = r.execHook(ctx, hookName, hook)
+		if err == nil {
+			r.promHookCount.WithLabelValues(hookName).Inc()
+			return nil
+		}
+		r.promHookErrorCount.WithLabelValues(hookName).Inc()
+		glog.Errorf("Failed %s hook attempt %d/%d: %v", hookName, i, attempts, err)
+		if i == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hookRetryDelay * time.Duration(i)):
+		}
+	}
+	if hook.Policy == HookPolicyIgnore {
+		glog.Warningf("Ignoring the failure of the %s hook", hookName)
+		return nil
+	}
+	return err
+}
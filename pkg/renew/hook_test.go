@@ -0,0 +1,104 @@
+package renew
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/generate"
+)
+
+func newHookTestRenew(tempDir string) *Renew {
+	return &Renew{
+		conf: &Config{
+			Operation: operation.NewOperation(&operation.Config{
+				SourceConfig: &generate.Config{
+					Name:              "foo-bar",
+					CommonName:        "foo",
+					PrivateKeyABSPath: path.Join(tempDir, "a.private_key"),
+					CSRABSPath:        path.Join(tempDir, "a.csr"),
+				},
+				Fetch: &fetch.Fetch{
+					Conf: &fetch.Config{
+						CertificateABSPath: path.Join(tempDir, "a.certificate"),
+					},
+				},
+			}),
+		},
+		promHookCount:      prometheus.NewCounterVec(prometheus.CounterOpts{Name: "total_hook"}, []string{"hook"}),
+		promHookErrorCount: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "total_hook_errors"}, []string{"hook"}),
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	r := newHookTestRenew(tempDir)
+	for _, tc := range []struct {
+		name string
+		hook *Hook
+		err  bool
+	}{
+		{
+			name: "no hook",
+		},
+		{
+			name: "success",
+			hook: &Hook{Command: "true", Timeout: time.Second, Policy: HookPolicyFail},
+		},
+		{
+			name: "fail",
+			hook: &Hook{Command: "exit 1", Timeout: time.Second, Policy: HookPolicyFail},
+			err:  true,
+		},
+		{
+			name: "ignore",
+			hook: &Hook{Command: "exit 1", Timeout: time.Second, Policy: HookPolicyIgnore},
+		},
+		{
+			name: "retry",
+			hook: &Hook{Command: "exit 1", Timeout: time.Second, Policy: HookPolicyRetry, Retries: 1},
+			err:  true,
+		},
+		{
+			name: "timeout",
+			hook: &Hook{Command: "sleep 5", Timeout: time.Millisecond * 100, Policy: HookPolicyFail},
+			err:  true,
+		},
+		{
+			name: "env",
+			hook: &Hook{Command: `test "${KUBE_CSR_HOOK}" = post-renew && test "${KUBE_CSR_CSR_NAME}" = foo-bar && test -n "${KUBE_CSR_CERTIFICATE_FILE}"`, Timeout: time.Second, Policy: HookPolicyFail},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := r.runHook(context.Background(), postRenewHook, tc.hook)
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestHookValidate(t *testing.T) {
+	assert.NoError(t, (&Hook{Command: "true", Timeout: time.Second, Policy: HookPolicyFail}).validate())
+	assert.NoError(t, (&Hook{Command: "true", Timeout: time.Second, Policy: HookPolicyRetry, Retries: 2}).validate())
+	assert.Error(t, (&Hook{Command: "true", Timeout: time.Second, Policy: HookPolicyRetry}).validate())
+	assert.Error(t, (&Hook{Command: "true", Policy: HookPolicyIgnore}).validate())
+	assert.Error(t, (&Hook{Command: "true", Timeout: time.Second, Policy: "foo"}).validate())
+}
+
+func TestRenewCommandHook(t *testing.T) {
+	assert.Nil(t, renewCommandHook(""))
+	hook := renewCommandHook("true")
+	assert.Equal(t, &Hook{Command: "true", Timeout: DefaultHookTimeout, Policy: HookPolicyFail}, hook)
+	assert.NoError(t, hook.validate())
+}
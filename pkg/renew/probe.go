@@ -0,0 +1,74 @@
+package renew
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// setCheckTimes records the last and the next check of the certificate for the liveness probe
+func (r *Renew) setCheckTimes(lastCheck, nextCheck time.Time) {
+	r.probeMu.Lock()
+	r.lastCheck, r.nextCheck = lastCheck, nextCheck
+	r.probeMu.Unlock()
+}
+
+// Healthz fails when the renew loop is late of a full check interval after the scheduled check
+func (r *Renew) Healthz() (map[string]string, error) {
+	r.probeMu.RLock()
+	lastCheck, nextCheck := r.lastCheck, r.nextCheck
+	r.probeMu.RUnlock()
+
+	details := map[string]string{
+		"nextCheck": nextCheck.Format(time.RFC3339),
+	}
+	if !lastCheck.IsZero() {
+		details["lastCheck"] = lastCheck.Format(time.RFC3339)
+	}
+	if nextCheck.IsZero() {
+		return details, fmt.Errorf("renew loop not started")
+	}
+	deadline := nextCheck.Add(r.conf.RenewCheckInterval)
+	if time.Now().After(deadline) {
+		return details, fmt.Errorf("renew loop is stuck, the check scheduled at %s is late", nextCheck.Format(time.RFC3339))
+	}
+	return details, nil
+}
+
+// Readyz fails when the certificate on disk is not valid now or doesn't match the private key
+func (r *Renew) Readyz() (map[string]string, error) {
+	certABSPath := r.conf.Operation.Fetch.Conf.CertificateABSPath
+	privateKeyABSPath := r.conf.Operation.SourceConfig.PrivateKeyABSPath
+	details := map[string]string{
+		"certificate": certABSPath,
+		"privateKey":  privateKeyABSPath,
+	}
+	cert, err := pemio.ReadCertificate(certABSPath)
+	if err != nil {
+		return details, err
+	}
+	details["serial"] = cert.SerialNumber.String()
+	details["notBefore"] = cert.NotBefore.Format(time.RFC3339)
+	details["notAfter"] = cert.NotAfter.Format(time.RFC3339)
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) {
+		return details, fmt.Errorf("certificate %s not valid before %s", certABSPath, cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return details, fmt.Errorf("certificate %s expired since %s", certABSPath, cert.NotAfter.Format(time.RFC3339))
+	}
+	key, err := pemio.ReadPrivateKey(privateKeyABSPath)
+	if err != nil {
+		return details, err
+	}
+	match, err := pemio.MatchPublicKey(cert.PublicKey, key.Public())
+	if err != nil {
+		return details, err
+	}
+	if !match {
+		return details, fmt.Errorf("certificate %s does not match the private key %s", certABSPath, privateKeyABSPath)
+	}
+	return details, nil
+}
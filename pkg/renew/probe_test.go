@@ -0,0 +1,86 @@
+package renew
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+func writeCertificateOrDie(absPath string, key *rsa.PrivateKey, notBefore, notAfter time.Time) {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(absPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	r := newHookTestRenew(tempDir)
+	certABSPath := r.conf.Operation.Fetch.Conf.CertificateABSPath
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	require.NoError(t, pemio.WritePem(x509.MarshalPKCS1PrivateKey(key), "RSA PRIVATE KEY", r.conf.Operation.SourceConfig.PrivateKeyABSPath, 0600, false))
+
+	// missing certificate
+	_, err = r.Readyz()
+	assert.Error(t, err)
+
+	now := time.Now()
+	writeCertificateOrDie(certABSPath, key, now.Add(-time.Hour), now.Add(time.Hour))
+	details, err := r.Readyz()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", details["serial"])
+
+	writeCertificateOrDie(certABSPath, key, now.Add(-time.Hour*2), now.Add(-time.Hour))
+	_, err = r.Readyz()
+	assert.Error(t, err)
+
+	writeCertificateOrDie(certABSPath, otherKey, now.Add(-time.Hour), now.Add(time.Hour))
+	_, err = r.Readyz()
+	assert.Error(t, err)
+}
+
+func TestHealthz(t *testing.T) {
+	r := &Renew{
+		conf: &Config{
+			RenewCheckInterval: time.Minute,
+		},
+	}
+	_, err := r.Healthz()
+	assert.Error(t, err)
+
+	now := time.Now()
+	r.setCheckTimes(now, now.Add(time.Minute))
+	_, err = r.Healthz()
+	assert.NoError(t, err)
+
+	r.setCheckTimes(now.Add(-time.Hour), now.Add(-time.Minute*2))
+	_, err = r.Healthz()
+	assert.Error(t, err)
+}
@@ -1,35 +1,75 @@
 package renew
 
 import (
+	"context"
 	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
-	"os/exec"
-	"os/signal"
-	"syscall"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/uuid"
 
 	"github.com/JulienBalestra/kube-csr/pkg/operation"
+	"github.com/JulienBalestra/kube-csr/pkg/reload"
 	"github.com/JulienBalestra/kube-csr/pkg/utils/api"
 	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
-	"strings"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+	"github.com/JulienBalestra/kube-csr/pkg/verify"
 )
 
 // Config of the Renew
 type Config struct {
-	Operation                     *operation.Operation
-	RenewThreshold                time.Duration
-	RenewCommand                  string
-	ExitOnRenew                   bool
-	GenerateNewKubernetesCSR      bool
+	Operation                *operation.Operation
+	RenewThreshold           time.Duration
+	ExitOnRenew              bool
+	GenerateNewKubernetesCSR bool
+	// SupersededCSRPolicy is applied to the previous csr when GenerateNewKubernetesCSR creates a new one,
+	// the SupersededCSRKeep is used when empty while the command line deletes it by default
+	SupersededCSRPolicy           string
 	PrometheusExporterBindAddress string
 	RenewCheckInterval            time.Duration
+
+	// RenewLifetimeFraction overrides the RenewThreshold when positive:
+	// the renew starts once this fraction of NotAfter - NotBefore is elapsed
+	RenewLifetimeFraction float64
+	// RenewJitter randomizes the renew threshold and the check interval by +/- this fraction
+	RenewJitter float64
+	// RenewRetryDelay is the first delay before retrying a failed renew, doubled on each
+	// consecutive error up to RenewRetryMaxDelay
+	RenewRetryDelay    time.Duration
+	RenewRetryMaxDelay time.Duration
+	// ExitOnExpired returns an error from Renew when the renew fails with an expired certificate
+	ExitOnExpired bool
+	// DisableFileWatch disables the check of the certificate on changes of the private key, csr and certificate files
+	DisableFileWatch bool
+	// DisableRevocationWatch disables the watch of the fetched csr, a revoked csr is renewed with a new private key
+	DisableRevocationWatch bool
+	// DisablePreflight disables the verify of the private key, the csr and the permissions of the certificate before starting
+	DisablePreflight bool
+
+	// ForceRenewBindAddress serves the POST /renew forcing a renew, disabled when empty, it must be a loopback address
+	ForceRenewBindAddress string
+	// ForceRenewMinInterval is the minimum duration between two forced renews, the ones in between are rejected
+	ForceRenewMinInterval time.Duration
+
+	// PreRenewHook is executed before the renew, PostRenewHook after a successful one
+	PreRenewHook  *Hook
+	PostRenewHook *Hook
+	// RenewCommand is executed after a successful renew when the PostRenewHook is nil
+	//
+	// Deprecated: use the PostRenewHook, the RenewCommand runs as one with the HookPolicyFail and the DefaultHookTimeout
+	RenewCommand string
+
+	// Reloaders are notified after a successful renew, each one within the ReloadTimeout
+	Reloaders     []reload.Reloader
+	ReloadTimeout time.Duration
 }
 
 // Renew state
@@ -37,11 +77,34 @@ type Renew struct {
 	conf *Config
 
 	kubernetesCSRBasename string
+	fetchedCSRName        string
+	forceRenewCh          chan chan error
 	kubeClient            *kubeclient.KubeClient
-	promCertExpiration    prometheus.Gauge
-	promCertNextRenew     prometheus.Gauge
-	promRenewCount        prometheus.Counter
-	promRenewErrorCount   prometheus.Counter
+	rand                  *rand.Rand
+	thresholdJitter       float64
+	notAfter              time.Time
+	consecutiveErrors     int
+	revoked               bool
+	lastForceRenew        time.Time
+
+	probeMu   sync.RWMutex
+	lastCheck time.Time
+	nextCheck time.Time
+
+	promCertExpiration       prometheus.Gauge
+	promCertNextRenew        prometheus.Gauge
+	promRenewCount           prometheus.Counter
+	promRenewErrorCount      prometheus.Counter
+	promReloadCount          *prometheus.CounterVec
+	promReloadErrorCount     *prometheus.CounterVec
+	promHookCount            *prometheus.CounterVec
+	promHookErrorCount       *prometheus.CounterVec
+	promConsecutiveErrors    prometheus.Gauge
+	promSupersededCount      prometheus.Counter
+	promSupersededErrors     prometheus.Counter
+	promForceRenewCount      prometheus.Counter
+	promForceRenewErrorCount prometheus.Counter
+	promRevocationCount      prometheus.Counter
 }
 
 // RegisterPrometheusMetrics is a convenient function to create and register prometheus metrics
@@ -63,6 +126,46 @@ func RegisterPrometheusMetrics(r *Renew) error {
 		Name: "seconds_before_renew",
 		Help: "Total number of seconds left before the certificate is renewed",
 	})
+	r.promConsecutiveErrors = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "renew_consecutive_errors",
+		Help: "Number of consecutive renew errors, reset on success",
+	})
+	r.promForceRenewCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_force_renew",
+		Help: "Total number of forced certificate renew",
+	})
+	r.promForceRenewErrorCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_force_renew_errors",
+		Help: "Total number of forced certificate renew errors",
+	})
+	r.promRevocationCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_revocation",
+		Help: "Total number of revocations of the fetched Kubernetes csr",
+	})
+	r.promSupersededCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_superseded_csr",
+		Help: "Total number of superseded Kubernetes csr cleaned up after a renew",
+	})
+	r.promSupersededErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "total_superseded_csr_errors",
+		Help: "Total number of errors during the clean up of superseded Kubernetes csr",
+	})
+	r.promReloadCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "total_reload",
+		Help: "Total number of successful reloads after a renew, by action",
+	}, []string{"action"})
+	r.promReloadErrorCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "total_reload_errors",
+		Help: "Total number of reload errors after a renew, by action",
+	}, []string{"action"})
+	r.promHookCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "total_hook",
+		Help: "Total number of successful hook executions, by hook",
+	}, []string{"hook"})
+	r.promHookErrorCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "total_hook_errors",
+		Help: "Total number of failed hook executions, by hook",
+	}, []string{"hook"})
 	err := prometheus.Register(r.promRenewCount)
 	if err != nil {
 		return err
@@ -79,6 +182,46 @@ func RegisterPrometheusMetrics(r *Renew) error {
 	if err != nil {
 		return err
 	}
+	err = prometheus.Register(r.promConsecutiveErrors)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promForceRenewCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promForceRenewErrorCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promRevocationCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promSupersededCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promSupersededErrors)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promReloadCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promReloadErrorCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promHookCount)
+	if err != nil {
+		return err
+	}
+	err = prometheus.Register(r.promHookErrorCount)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -99,19 +242,98 @@ func checkPaths(paths ...string) error {
 	return fmt.Errorf("%s", strings.Join(errs, ", "))
 }
 
-// NewRenewer instantiate a new Renew with the given config
+// NewRenewer instantiate a new Renew with the given config, pass kubeConfigPath == "" to use the InCluster config
 func NewRenewer(kubeConfigPath string, conf *Config) (*Renew, error) {
+	return NewRenewerFromConfig(&kubeclient.Config{KubeConfigPath: kubeConfigPath}, conf)
+}
+
+// NewRenewerFromConfig is the NewRenewer with the context, the impersonation and the tuning of the Kubernetes client
+func NewRenewerFromConfig(kubeConfig *kubeclient.Config, conf *Config) (*Renew, error) {
 	if conf.RenewCheckInterval <= 0 {
 		err := fmt.Errorf("non-positive interval for the renew check interval: %d", conf.RenewCheckInterval)
 		glog.Errorf("Cannot use the given configuration: %v", err)
 		return nil, err
 	}
-	err := checkPaths(conf.Operation.SourceConfig.PrivateKeyABSPath, conf.Operation.SourceConfig.CSRABSPath, conf.Operation.Fetch.Conf.CertificateABSPath)
+	if conf.RenewLifetimeFraction < 0 || conf.RenewLifetimeFraction >= 1 {
+		err := fmt.Errorf("invalid value for the renew lifetime fraction, must be in [0, 1): %g", conf.RenewLifetimeFraction)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.RenewJitter < 0 || conf.RenewJitter >= 1 {
+		err := fmt.Errorf("invalid value for the renew jitter, must be in [0, 1): %g", conf.RenewJitter)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.RenewLifetimeFraction > 0 && (1-conf.RenewLifetimeFraction)*(1+conf.RenewJitter) >= 1 {
+		err := fmt.Errorf("the renew jitter %g with the lifetime fraction %g can reach the certificate lifetime", conf.RenewJitter, conf.RenewLifetimeFraction)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.RenewRetryDelay <= 0 || conf.RenewRetryMaxDelay < conf.RenewRetryDelay {
+		err := fmt.Errorf("invalid renew retry delays: %s, max %s", conf.RenewRetryDelay, conf.RenewRetryMaxDelay)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.SupersededCSRPolicy == "" {
+		conf.SupersededCSRPolicy = SupersededCSRKeep
+	}
+	err := validateSupersededCSRPolicy(conf.SupersededCSRPolicy)
+	if err != nil {
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.ForceRenewBindAddress != "" && !api.IsLoopbackAddress(conf.ForceRenewBindAddress) {
+		err := fmt.Errorf("the force renew bind address must be a loopback one: %q", conf.ForceRenewBindAddress)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.ForceRenewMinInterval < 0 {
+		err := fmt.Errorf("negative interval for the force renew: %s", conf.ForceRenewMinInterval)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if len(conf.Reloaders) > 0 && conf.ReloadTimeout <= 0 {
+		err := fmt.Errorf("non-positive timeout for the reload: %s", conf.ReloadTimeout)
+		glog.Errorf("Cannot use the given configuration: %v", err)
+		return nil, err
+	}
+	if conf.PostRenewHook == nil {
+		conf.PostRenewHook = renewCommandHook(conf.RenewCommand)
+	}
+	for _, hook := range []*Hook{conf.PreRenewHook, conf.PostRenewHook} {
+		if hook == nil || hook.Command == "" {
+			continue
+		}
+		err := hook.validate()
+		if err != nil {
+			glog.Errorf("Cannot use the given configuration: %v", err)
+			return nil, err
+		}
+	}
+	// a missing certificate is reissued by the first renew
+	err = checkPaths(conf.Operation.SourceConfig.PrivateKeyABSPath, conf.Operation.SourceConfig.CSRABSPath)
 	if err != nil {
 		glog.Errorf("Missing files: %v", err)
 		return nil, err
 	}
-	k, err := kubeclient.NewKubeClient(kubeConfigPath)
+	if !conf.DisablePreflight {
+		err = verify.Verify(&verify.Config{
+			PrivateKeyABSPath:       conf.Operation.SourceConfig.PrivateKeyABSPath,
+			CSRABSPath:              conf.Operation.SourceConfig.CSRABSPath,
+			CertificateABSPath:      conf.Operation.Fetch.Conf.CertificateABSPath,
+			PrivateKeyPermission:    conf.Operation.SourceConfig.PrivateKeyPermission,
+			CSRPermission:           conf.Operation.SourceConfig.CSRPermission,
+			CertificatePermission:   conf.Operation.Fetch.Conf.CertificatePermission,
+			AllowMissingCertificate: true,
+			// a corrupted, expired or mismatching certificate is reissued by the first renew
+			CertificatePermissionOnly: true,
+		})
+		if err != nil {
+			glog.Errorf("Failed preflight, use --renew-disable-preflight to skip it: %v", err)
+			return nil, err
+		}
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +343,11 @@ func NewRenewer(kubeConfigPath string, conf *Config) (*Renew, error) {
 		conf:                  conf,
 		kubeClient:            k,
 		kubernetesCSRBasename: conf.Operation.SourceConfig.Name,
+		fetchedCSRName:        conf.Operation.SourceConfig.Name,
+		forceRenewCh:          make(chan chan error),
+		rand:                  rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
+	r.rollThresholdJitter()
 	err = RegisterPrometheusMetrics(r)
 	if err != nil {
 		return nil, err
@@ -129,30 +355,57 @@ func NewRenewer(kubeConfigPath string, conf *Config) (*Renew, error) {
 	return r, nil
 }
 
+// jitter returns a random factor in [-RenewJitter, RenewJitter)
+func (r *Renew) jitter() float64 {
+	if r.conf.RenewJitter == 0 {
+		return 0
+	}
+	return (r.rand.Float64()*2 - 1) * r.conf.RenewJitter
+}
+
+// rollThresholdJitter picks the threshold jitter kept until the next renew
+func (r *Renew) rollThresholdJitter() {
+	r.thresholdJitter = r.jitter()
+}
+
+// nextCheckInterval returns the RenewCheckInterval with a jitter
+func (r *Renew) nextCheckInterval() time.Duration {
+	return r.conf.RenewCheckInterval + time.Duration(float64(r.conf.RenewCheckInterval)*r.jitter())
+}
+
+// renewThreshold returns the duration before the NotAfter of the certificate when the renew starts
+func (r *Renew) renewThreshold(cert *x509.Certificate) time.Duration {
+	threshold := r.conf.RenewThreshold
+	if r.conf.RenewLifetimeFraction > 0 {
+		lifetime := cert.NotAfter.Sub(cert.NotBefore)
+		threshold = lifetime - time.Duration(float64(lifetime)*r.conf.RenewLifetimeFraction)
+	}
+	return threshold + time.Duration(float64(threshold)*r.thresholdJitter)
+}
+
 func (r *Renew) shouldRenew() (bool, error) {
 	certABSPath := r.conf.Operation.Fetch.Conf.CertificateABSPath
 	b, err := ioutil.ReadFile(certABSPath)
+	if os.IsNotExist(err) {
+		glog.Warningf("Certificate %s is missing, needs renew", certABSPath)
+		return true, nil
+	}
 	if err != nil {
 		glog.Errorf("Cannot read current certificate: %v", err)
 		return false, err
 	}
-	p, _ := pem.Decode(b)
-	if p == nil {
-		err = fmt.Errorf("cannot parse certificate %s", certABSPath)
-		glog.Errorf("Unexpected error: %v")
-		return false, err
-	}
-	cert, err := x509.ParseCertificate(p.Bytes)
+	cert, err := pemio.ParseCertificate(b)
 	if err != nil {
-		glog.Errorf("Cannot parse %s as certificate: %v", certABSPath, err)
-		return false, err
+		glog.Warningf("Cannot use %s as certificate, needs renew: %v", certABSPath, err)
+		return true, nil
 	}
 	now := time.Now()
+	r.notAfter = cert.NotAfter
 
 	timeLeft := cert.NotAfter.Sub(now)
 	r.promCertExpiration.Set(timeLeft.Seconds())
 
-	timeLeftThreshold := timeLeft - r.conf.RenewThreshold
+	timeLeftThreshold := timeLeft - r.renewThreshold(cert)
 	r.promCertNextRenew.Set(timeLeftThreshold.Seconds())
 
 	glog.V(0).Infof("Certificate %s is valid until: %s, time left: %s, time left with threshold: %s", certABSPath, cert.NotAfter, timeLeft.Round(time.Second).String(), timeLeftThreshold.String())
@@ -164,36 +417,131 @@ func (r *Renew) shouldRenew() (bool, error) {
 	return true, nil
 }
 
-func (r *Renew) processRenew() (bool, error) {
+// processRenew renews the certificate when needed, force bypasses the renew threshold
+// a revoked csr forces the renew with a new private key and a new csr
+func (r *Renew) processRenew(ctx context.Context, force bool) (bool, error) {
+	revoked := r.revoked
+	force = force || revoked
 	needRenew, err := r.shouldRenew()
-	if err != nil {
+	if err != nil && !force {
 		return false, err
 	}
-	if !needRenew {
+	if !needRenew && !force {
 		return false, nil
 	}
-	if r.conf.GenerateNewKubernetesCSR {
+	if r.conf.GenerateNewKubernetesCSR || revoked {
+		// the revoked csr is kept for audit
 		r.conf.Operation.SourceConfig.Name = fmt.Sprintf("%s-%s", r.kubernetesCSRBasename, uuid.NewUUID()[:13])
 	}
+	err = r.runHook(ctx, preRenewHook, r.conf.PreRenewHook)
+	if err != nil {
+		glog.Errorf("Aborting the renew: %v", err)
+		return false, err
+	}
+	var restorePrivateKey func()
+	if revoked {
+		restorePrivateKey, err = r.rotatePrivateKey()
+		if err != nil {
+			return false, err
+		}
+	}
 	glog.V(0).Infof("Renewing CN=%s csr/%s ...", r.conf.Operation.SourceConfig.CommonName, r.conf.Operation.SourceConfig.Name)
-	err = r.conf.Operation.Run()
+	err = r.conf.Operation.Run(ctx)
 	if err != nil {
+		if restorePrivateKey != nil {
+			// the previous certificate matches the previous private key until the next renew
+			restorePrivateKey()
+		}
 		return false, err
 	}
 	r.promRenewCount.Inc()
+	r.rollThresholdJitter()
 	glog.V(0).Infof("Successfully renewed")
+
+	// the certificate is installed, the previous csr is superseded
+	previousCSRName := r.fetchedCSRName
+	r.fetchedCSRName = r.conf.Operation.SourceConfig.Name
+	if revoked {
+		r.revoked = false
+		glog.V(0).Infof("Keeping the revoked csr/%s for audit", previousCSRName)
+		return true, nil
+	}
+	superseded, err := r.supersede(previousCSRName, r.fetchedCSRName)
+	if err != nil {
+		r.promSupersededErrors.Inc()
+	}
+	if superseded {
+		r.promSupersededCount.Inc()
+	}
 	return true, nil
 }
 
-// Renew starts the renew process
-func (r *Renew) Renew() error {
-	api.RegisterAPI(r.conf.PrometheusExporterBindAddress, api.PprofBindDefault)
+// reload notifies the Reloaders, the errors are only reported in the metrics
+func (r *Renew) reload(ctx context.Context) {
+	for _, reloader := range r.conf.Reloaders {
+		glog.V(0).Infof("Reloading with %s ...", reloader.String())
+		reloadCtx, cancel := context.WithTimeout(ctx, r.conf.ReloadTimeout)
+		err := reloader.Reload(reloadCtx)
+		cancel()
+		if err != nil {
+			glog.Errorf("Cannot reload with %s: %v", reloader.String(), err)
+			r.promReloadErrorCount.WithLabelValues(reloader.Action()).Inc()
+			continue
+		}
+		r.promReloadCount.WithLabelValues(reloader.Action()).Inc()
+	}
+}
+
+// checkAndRenew calls processRenew and notifies the renewedCh on success,
+// returns the delay before the next check: the check interval or the retry delay
+func (r *Renew) checkAndRenew(ctx context.Context, renewedCh chan<- struct{}) (time.Duration, error) {
+	renewed, err := r.processRenew(ctx, false)
+	if ctx.Err() != nil {
+		return r.nextCheckInterval(), nil
+	}
+	if err != nil {
+		r.promRenewErrorCount.Inc()
+		r.consecutiveErrors++
+		r.promConsecutiveErrors.Set(float64(r.consecutiveErrors))
+		now := time.Now()
+		if r.isExpired(now) {
+			glog.Errorf("Certificate %s expired since %s and cannot be renewed: %v", r.conf.Operation.Fetch.Conf.CertificateABSPath, now.Sub(r.notAfter).Round(time.Second), err)
+			if r.conf.ExitOnExpired {
+				return 0, fmt.Errorf("certificate expired since %s: %v", r.notAfter, err)
+			}
+		}
+		delay := r.retryDelay(now)
+		glog.Warningf("Renew failed %d consecutive times, retrying in %s", r.consecutiveErrors, delay)
+		return delay, nil
+	}
+	r.consecutiveErrors = 0
+	r.promConsecutiveErrors.Set(0)
+	if renewed {
+		select {
+		case renewedCh <- struct{}{}:
+		default:
+			glog.V(1).Infof("Renew already notified")
+		}
+	}
+	return r.nextCheckInterval(), nil
+}
+
+// Renew starts the renew process, returns when the context is done
+func (r *Renew) Renew(ctx context.Context) error {
+	r.setCheckTimes(time.Time{}, time.Now())
+	api.RegisterAPI(r.conf.PrometheusExporterBindAddress, api.PprofBindDefault, &api.Probes{
+		Healthz: r.Healthz,
+		Readyz:  r.Readyz,
+	})
+	if r.conf.ForceRenewBindAddress != "" {
+		api.RegisterRoutes(r.conf.ForceRenewBindAddress, r.forceRenewRoute())
+	}
 
 	renewedCh := make(chan struct{}, 1)
 	defer close(renewedCh)
 
 	// processRenew once and fail fast to crash the Pod in case of error
-	renewed, err := r.processRenew()
+	renewed, err := r.processRenew(ctx, false)
 	if err != nil {
 		return err
 	}
@@ -201,43 +549,121 @@ func (r *Renew) Renew() error {
 		renewedCh <- struct{}{}
 	}
 
-	sigCh := make(chan os.Signal)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sigCh)
+	checkInterval := r.nextCheckInterval()
+	timer := time.NewTimer(checkInterval)
+	defer timer.Stop()
+	now := time.Now()
+	r.setCheckTimes(now, now.Add(checkInterval))
 
-	ticker := time.NewTicker(r.conf.RenewCheckInterval)
-	defer ticker.Stop()
+	// nil channels block forever when the file watch is disabled
+	var watcher *fileWatcher
+	var watchEvents <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if !r.conf.DisableFileWatch {
+		watcher, err = newFileWatcher(
+			r.conf.Operation.SourceConfig.PrivateKeyABSPath,
+			r.conf.Operation.SourceConfig.CSRABSPath,
+			r.conf.Operation.Fetch.Conf.CertificateABSPath,
+		)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+		watchEvents, watchErrors = watcher.Events, watcher.Errors
+	}
+	revokedCh := make(chan revocation, 1)
+	watchedCSRName := r.fetchedCSRName
+	stopRevocationWatch := r.startRevocationWatch(ctx, revokedCh)
+	defer func() {
+		stopRevocationWatch()
+	}()
 
-	glog.V(0).Infof("Starting the renew process for the certificate %s, check every %s", r.conf.Operation.Fetch.Conf.CertificateABSPath, r.conf.RenewCheckInterval)
+	debounce := time.NewTimer(watchDebounce)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+	defer debounce.Stop()
+
+	// reschedule the next check after each one
+	check := func() error {
+		next, err := r.checkAndRenew(ctx, renewedCh)
+		if err != nil {
+			return err
+		}
+		checkInterval = next
+		resetTimer(timer, checkInterval)
+		now := time.Now()
+		r.setCheckTimes(now, now.Add(checkInterval))
+		glog.V(1).Infof("Next check of the certificate %s in %s", r.conf.Operation.Fetch.Conf.CertificateABSPath, checkInterval)
+		return nil
+	}
+
+	glog.V(0).Infof("Starting the renew process for the certificate %s, next check in %s", r.conf.Operation.Fetch.Conf.CertificateABSPath, checkInterval)
 	for {
 		select {
-		case s := <-sigCh:
-			glog.Infof("Signal %s received, exiting ...", s.String())
+		case <-ctx.Done():
+			glog.Infof("Exiting the renew process: %v", ctx.Err())
 			return nil
 
 		case <-renewedCh:
-			if r.conf.RenewCommand != "" {
-				b, err := exec.Command("/bin/sh", "-c", r.conf.RenewCommand).CombinedOutput()
-				glog.V(0).Infof("Renew command %q output:\n%s", r.conf.RenewCommand, string(b))
-				if err != nil {
+			if watchedCSRName != r.fetchedCSRName {
+				stopRevocationWatch()
+				watchedCSRName = r.fetchedCSRName
+				stopRevocationWatch = r.startRevocationWatch(ctx, revokedCh)
+			}
+			err := r.runHook(ctx, postRenewHook, r.conf.PostRenewHook)
+			if err != nil {
+				if r.conf.ExitOnRenew {
 					return err
 				}
+				// the new certificate is already installed, the sidecar keeps running
+				r.promRenewErrorCount.Inc()
 			}
+			r.reload(ctx)
 			if !r.conf.ExitOnRenew {
-				glog.V(0).Infof("Restarting the renew process for the certificate %s, check every %s", r.conf.Operation.Fetch.Conf.CertificateABSPath, r.conf.RenewCheckInterval)
+				glog.V(0).Infof("Restarting the renew process for the certificate %s, next check in %s", r.conf.Operation.Fetch.Conf.CertificateABSPath, checkInterval)
 				continue
 			}
 			glog.V(0).Infof("Exit on successful renew")
 			return nil
 
-		case <-ticker.C:
-			renewed, err := r.processRenew()
-			if err != nil {
-				r.promRenewErrorCount.Inc()
+		case event := <-watchEvents:
+			if !watcher.isWatched(event) {
+				continue
+			}
+			glog.V(1).Infof("File event %s, checking the certificate in %s", event.String(), watchDebounce)
+			resetTimer(debounce, watchDebounce)
+
+		case rev := <-revokedCh:
+			if rev.csrName != r.fetchedCSRName {
+				glog.V(1).Infof("Ignoring the revocation of the superseded csr/%s", rev.csrName)
 				continue
 			}
-			if renewed {
-				renewedCh <- struct{}{}
+			glog.Warningf("csr/%s is revoked: %q, renewing with a new private key", rev.csrName, rev.reason)
+			r.promRevocationCount.Inc()
+			r.revoked = true
+			err := check()
+			if err != nil {
+				return err
+			}
+
+		case resultCh := <-r.forceRenewCh:
+			resultCh <- r.forceRenew(ctx, renewedCh)
+
+		case err := <-watchErrors:
+			glog.Errorf("Unexpected error from the file watcher: %v", err)
+
+		case <-debounce.C:
+			glog.V(0).Infof("Checking the certificate %s after file changes", r.conf.Operation.Fetch.Conf.CertificateABSPath)
+			err := check()
+			if err != nil {
+				return err
+			}
+
+		case <-timer.C:
+			err := check()
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -0,0 +1,125 @@
+package renew
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+)
+
+func TestRenewThreshold(t *testing.T) {
+	notBefore := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		conf            *Config
+		thresholdJitter float64
+		lifetime        time.Duration
+		threshold       time.Duration
+	}{
+		{
+			conf: &Config{
+				RenewThreshold: time.Hour,
+			},
+			lifetime:  time.Hour * 24,
+			threshold: time.Hour,
+		},
+		{
+			conf: &Config{
+				RenewThreshold:        time.Hour,
+				RenewLifetimeFraction: 0.75,
+			},
+			lifetime:  time.Hour * 24,
+			threshold: time.Hour * 6,
+		},
+		{
+			conf: &Config{
+				RenewThreshold:        time.Hour,
+				RenewLifetimeFraction: 0.5,
+			},
+			thresholdJitter: 0.1,
+			lifetime:        time.Hour * 10,
+			threshold:       time.Hour*5 + time.Minute*30,
+		},
+		{
+			conf: &Config{
+				RenewThreshold: time.Hour,
+			},
+			thresholdJitter: -0.5,
+			lifetime:        time.Hour * 10,
+			threshold:       time.Minute * 30,
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			r := &Renew{
+				conf:            tc.conf,
+				thresholdJitter: tc.thresholdJitter,
+			}
+			cert := &x509.Certificate{
+				NotBefore: notBefore,
+				NotAfter:  notBefore.Add(tc.lifetime),
+			}
+			assert.Equal(t, tc.threshold, r.renewThreshold(cert))
+		})
+	}
+}
+
+func TestNextCheckInterval(t *testing.T) {
+	r := &Renew{
+		conf: &Config{
+			RenewCheckInterval: time.Minute * 10,
+		},
+		rand: rand.New(rand.NewSource(0)),
+	}
+	assert.Equal(t, time.Minute*10, r.nextCheckInterval())
+
+	r.conf.RenewJitter = 0.2
+	for i := 0; i < 100; i++ {
+		interval := r.nextCheckInterval()
+		assert.True(t, interval >= time.Minute*8, interval.String())
+		assert.True(t, interval < time.Minute*12, interval.String())
+	}
+}
+
+func TestShouldRenewUnusableCertificate(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	certABSPath := path.Join(tempDir, "a.certificate")
+	r := &Renew{
+		conf: &Config{
+			Operation: operation.NewOperation(&operation.Config{
+				Fetch: &fetch.Fetch{
+					Conf: &fetch.Config{
+						CertificateABSPath: certABSPath,
+					},
+				},
+			}),
+		},
+	}
+
+	// missing
+	renew, err := r.shouldRenew()
+	require.NoError(t, err)
+	assert.True(t, renew)
+
+	// not a pem
+	require.NoError(t, ioutil.WriteFile(certABSPath, []byte("corrupted"), 0600))
+	renew, err = r.shouldRenew()
+	require.NoError(t, err)
+	assert.True(t, renew)
+
+	// not a certificate
+	require.NoError(t, ioutil.WriteFile(certABSPath, []byte("-----BEGIN CERTIFICATE-----\nMTIz\n-----END CERTIFICATE-----\n"), 0600))
+	renew, err = r.shouldRenew()
+	require.NoError(t, err)
+	assert.True(t, renew)
+}
@@ -0,0 +1,156 @@
+package renew
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	certificates "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/generate"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/revoke"
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// revocationWatchRetryDelay is the delay before watching again the fetched csr after a watch error
+const revocationWatchRetryDelay = time.Second * 5
+
+// revocation of a fetched csr
+type revocation struct {
+	csrName string
+	reason  string
+}
+
+// startRevocationWatch watches the revocation of the fetched csr, the returned func stops the watch
+func (r *Renew) startRevocationWatch(ctx context.Context, revokedCh chan<- revocation) context.CancelFunc {
+	if r.conf.DisableRevocationWatch {
+		return func() {}
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	go r.watchRevocation(watchCtx, r.fetchedCSRName, revokedCh)
+	return cancel
+}
+
+// watchRevocation notifies the revokedCh once the csr is annotated as revoked, returns when the context is done
+func (r *Renew) watchRevocation(ctx context.Context, csrName string, revokedCh chan<- revocation) {
+	glog.V(1).Infof("Watching the revocation of csr/%s", csrName)
+	for {
+		reason, revoked, err := r.waitRevocation(ctx, csrName)
+		if ctx.Err() != nil {
+			return
+		}
+		if revoked {
+			select {
+			case revokedCh <- revocation{csrName: csrName, reason: reason}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		if err == nil {
+			glog.V(1).Infof("Watch of csr/%s ended, watching again", csrName)
+			continue
+		}
+		glog.Errorf("Cannot watch the revocation of csr/%s, retrying in %s: %v", csrName, revocationWatchRetryDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(revocationWatchRetryDelay):
+		}
+	}
+}
+
+// waitRevocation watches the csr until it's annotated as revoked or the watch ends
+func (r *Renew) waitRevocation(ctx context.Context, csrName string) (string, bool, error) {
+	w, err := r.kubeClient.GetCertificateClient().CertificateSigningRequests().Watch(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", csrName).String(),
+	})
+	if err != nil {
+		return "", false, err
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return "", false, nil
+			}
+			switch event.Type {
+			case watch.Error:
+				return "", false, errors.FromObject(event.Object)
+
+			case watch.Added, watch.Modified:
+				csr, ok := event.Object.(*certificates.CertificateSigningRequest)
+				if !ok {
+					return "", false, fmt.Errorf("unexpected object type %T", event.Object)
+				}
+				reason, revoked := revoke.IsRevoked(csr)
+				if revoked {
+					return reason, true, nil
+				}
+			}
+		}
+	}
+}
+
+// rotatePrivateKey generates a new private key and a new csr file, the private key of a revoked csr is compromised
+// the returned func restores the previous private key and csr files when the certificate isn't renewed
+func (r *Renew) rotatePrivateKey() (func(), error) {
+	sourceConfig := r.conf.Operation.SourceConfig
+	certABSPath := r.conf.Operation.Fetch.Conf.CertificateABSPath
+	backup := make(map[string][]byte)
+	for _, absPath := range []string{sourceConfig.PrivateKeyABSPath, sourceConfig.CSRABSPath, certABSPath} {
+		b, err := ioutil.ReadFile(absPath)
+		if err != nil && !os.IsNotExist(err) {
+			glog.Errorf("Cannot backup %s before the rotation of the private key: %v", absPath, err)
+			return nil, err
+		}
+		backup[absPath] = b
+	}
+	loadPrivateKey := sourceConfig.LoadPrivateKey
+	sourceConfig.LoadPrivateKey = false
+	defer func() {
+		sourceConfig.LoadPrivateKey = loadPrivateKey
+	}()
+	glog.V(0).Infof("Rotating the private key %s", sourceConfig.PrivateKeyABSPath)
+	restore := func() {
+		current, err := ioutil.ReadFile(certABSPath)
+		if err != nil && !os.IsNotExist(err) {
+			glog.Errorf("Cannot read the certificate %s, keeping the new private key: %v", certABSPath, err)
+			return
+		}
+		if !bytes.Equal(current, backup[certABSPath]) {
+			glog.V(0).Infof("Certificate %s is renewed, keeping the new private key", certABSPath)
+			return
+		}
+		glog.Warningf("Certificate %s isn't renewed, restoring the previous private key %s and csr %s", certABSPath, sourceConfig.PrivateKeyABSPath, sourceConfig.CSRABSPath)
+		for absPath, perm := range map[string]os.FileMode{
+			sourceConfig.PrivateKeyABSPath: sourceConfig.PrivateKeyPermission,
+			sourceConfig.CSRABSPath:        sourceConfig.CSRPermission,
+		} {
+			if backup[absPath] == nil {
+				continue
+			}
+			err = pemio.WriteFile(backup[absPath], absPath, perm, true)
+			if err != nil {
+				glog.Errorf("Cannot restore %s: %v", absPath, err)
+			}
+		}
+	}
+	err := generate.NewGenerator(sourceConfig).Generate()
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
@@ -0,0 +1,64 @@
+package renew
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+	"github.com/JulienBalestra/kube-csr/pkg/operation/generate"
+)
+
+func TestRotatePrivateKeyRestore(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	sourceConfig := &generate.Config{
+		CommonName:           "app",
+		RSABits:              1024,
+		PrivateKeyABSPath:    path.Join(tempDir, "app.private_key"),
+		PrivateKeyPermission: 0600,
+		CSRABSPath:           path.Join(tempDir, "app.csr"),
+		CSRPermission:        0600,
+		Override:             true,
+	}
+	certABSPath := path.Join(tempDir, "app.certificate")
+	r := &Renew{
+		conf: &Config{
+			Operation: operation.NewOperation(&operation.Config{
+				SourceConfig: sourceConfig,
+				Fetch:        &fetch.Fetch{Conf: &fetch.Config{CertificateABSPath: certABSPath}},
+			}),
+		},
+	}
+	read := func(absPath string) []byte {
+		b, err := ioutil.ReadFile(absPath)
+		require.NoError(t, err)
+		return b
+	}
+	require.NoError(t, generate.NewGenerator(sourceConfig).Generate())
+	require.NoError(t, ioutil.WriteFile(certABSPath, []byte("previous"), 0600))
+	previousKey, previousCSR := read(sourceConfig.PrivateKeyABSPath), read(sourceConfig.CSRABSPath)
+
+	// the renew failed, the certificate is the previous one
+	restore, err := r.rotatePrivateKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, previousKey, read(sourceConfig.PrivateKeyABSPath))
+	restore()
+	assert.Equal(t, previousKey, read(sourceConfig.PrivateKeyABSPath))
+	assert.Equal(t, previousCSR, read(sourceConfig.CSRABSPath))
+
+	// the certificate is renewed before the failure
+	restore, err = r.rotatePrivateKey()
+	require.NoError(t, err)
+	newKey := read(sourceConfig.PrivateKeyABSPath)
+	require.NoError(t, ioutil.WriteFile(certABSPath, []byte("renewed"), 0600))
+	restore()
+	assert.Equal(t, newKey, read(sourceConfig.PrivateKeyABSPath))
+}
@@ -0,0 +1,78 @@
+package renew
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/operation/fetch"
+)
+
+const (
+	// SupersededCSRKeep leaves the superseded csr to the garbage collection
+	SupersededCSRKeep = "keep"
+	// SupersededCSRAnnotate annotates the superseded csr with the csr replacing it
+	SupersededCSRAnnotate = "annotate"
+	// SupersededCSRDelete deletes the superseded csr
+	SupersededCSRDelete = "delete"
+
+	// KubeCSRSupersededByAnnotation is the name of the csr replacing the annotated one
+	KubeCSRSupersededByAnnotation = fetch.KubeCSRFetchedAnnotationPrefix + "supersededBy"
+	// KubeCSRSupersededTimeAnnotation is the date when the annotated csr has been replaced
+	KubeCSRSupersededTimeAnnotation = fetch.KubeCSRFetchedAnnotationPrefix + "supersededTime"
+)
+
+func validateSupersededCSRPolicy(policy string) error {
+	switch policy {
+	case SupersededCSRKeep, SupersededCSRAnnotate, SupersededCSRDelete:
+		return nil
+	}
+	return fmt.Errorf("invalid superseded csr policy %q, must be one of %s, %s, %s", policy, SupersededCSRKeep, SupersededCSRAnnotate, SupersededCSRDelete)
+}
+
+// supersede applies the SupersededCSRPolicy to the previous csr once its certificate is replaced by the one of csrName
+// returns if the previous csr has been deleted or annotated
+func (r *Renew) supersede(previousCSRName, csrName string) (bool, error) {
+	if previousCSRName == "" || previousCSRName == csrName || r.conf.SupersededCSRPolicy == SupersededCSRKeep {
+		return false, nil
+	}
+	csrClient := r.kubeClient.GetCertificateClient().CertificateSigningRequests()
+	if r.conf.SupersededCSRPolicy == SupersededCSRDelete {
+		err := csrClient.Delete(previousCSRName, &metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			glog.V(1).Infof("Superseded csr/%s already deleted", previousCSRName)
+			return false, nil
+		}
+		if err != nil {
+			glog.Errorf("Cannot delete superseded csr/%s: %v", previousCSRName, err)
+			return false, err
+		}
+		glog.V(0).Infof("Successfully deleted csr/%s superseded by csr/%s", previousCSRName, csrName)
+		return true, nil
+	}
+
+	csr, err := csrClient.Get(previousCSRName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		glog.V(1).Infof("Superseded csr/%s already deleted", previousCSRName)
+		return false, nil
+	}
+	if err != nil {
+		glog.Errorf("Cannot get superseded csr/%s: %v", previousCSRName, err)
+		return false, err
+	}
+	if csr.Annotations == nil {
+		csr.Annotations = make(map[string]string)
+	}
+	csr.Annotations[KubeCSRSupersededByAnnotation] = csrName
+	csr.Annotations[KubeCSRSupersededTimeAnnotation] = time.Now().UTC().Format(fetch.KubeCsrFetchedAnnotationDateFormat)
+	_, err = csrClient.Update(csr)
+	if err != nil {
+		glog.Errorf("Cannot annotate superseded csr/%s: %v", previousCSRName, err)
+		return false, err
+	}
+	glog.V(0).Infof("Successfully annotated csr/%s superseded by csr/%s", previousCSRName, csrName)
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package renew
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+const (
+	// watchDebounce is the delay to wait after the last file event before checking the certificate
+	// it avoids to check the certificate during the writes of a renew
+	watchDebounce = time.Second
+
+	// kubernetesAtomicWriterData is the symlink swapped by the kubelet on secret and configmap volume updates
+	kubernetesAtomicWriterData = "..data"
+)
+
+// fileWatcher notifies the changes over a set of files
+type fileWatcher struct {
+	*fsnotify.Watcher
+
+	files map[string]struct{}
+	dirs  map[string]struct{}
+}
+
+// newFileWatcher watches the parent directories of the given files
+// to be notified when the files are deleted, renamed or replaced
+func newFileWatcher(files ...string) (*fileWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Errorf("Cannot create file watcher: %v", err)
+		return nil, err
+	}
+	fw := &fileWatcher{
+		Watcher: w,
+		files:   make(map[string]struct{}, len(files)),
+		dirs:    make(map[string]struct{}),
+	}
+	for _, f := range files {
+		f = filepath.Clean(f)
+		fw.files[f] = struct{}{}
+		dir := filepath.Dir(f)
+		_, ok := fw.dirs[dir]
+		if ok {
+			continue
+		}
+		err = w.Add(dir)
+		if err != nil {
+			glog.Errorf("Cannot watch directory %s: %v", dir, err)
+			w.Close()
+			return nil, err
+		}
+		glog.V(1).Infof("Watching directory %s", dir)
+		fw.dirs[dir] = struct{}{}
+	}
+	return fw, nil
+}
+
+// isWatched returns if the event concerns one of the watched files
+func (fw *fileWatcher) isWatched(event fsnotify.Event) bool {
+	name := filepath.Clean(event.Name)
+	_, ok := fw.files[name]
+	if ok {
+		return true
+	}
+	if filepath.Base(name) != kubernetesAtomicWriterData {
+		return false
+	}
+	_, ok = fw.dirs[filepath.Dir(name)]
+	return ok
+}
@@ -0,0 +1,52 @@
+package renew
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWatcherIsWatched(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	w, err := newFileWatcher(path.Join(tempDir, "a.certificate"), path.Join(tempDir, "a.csr"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	for _, tc := range []struct {
+		name    string
+		watched bool
+	}{
+		{
+			name:    path.Join(tempDir, "a.certificate"),
+			watched: true,
+		},
+		{
+			name:    path.Join(tempDir, "a.csr"),
+			watched: true,
+		},
+		{
+			name:    path.Join(tempDir, "..data"),
+			watched: true,
+		},
+		{
+			name:    path.Join(tempDir, "a.private_key"),
+			watched: false,
+		},
+		{
+			name:    path.Join(os.TempDir(), "..data"),
+			watched: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.watched, w.isWatched(fsnotify.Event{Name: tc.name, Op: fsnotify.Write}))
+		})
+	}
+}
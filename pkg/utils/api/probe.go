@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// Probe returns the details of the state of a daemon and an error when it fails
+type Probe func() (map[string]string, error)
+
+// Probes are exposed next to the prometheus exporter
+// - Healthz for liveness
+// - Readyz for readiness
+type Probes struct {
+	Healthz Probe
+	Readyz  Probe
+}
+
+// Response is the JSON body of the probes and the JSONHandler
+type Response struct {
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func probeHandler(probe Probe) http.HandlerFunc {
+	return JSONHandler(func(r *http.Request) (map[string]string, error) {
+		return probe()
+	})
+}
+
+// JSONHandler writes the details and the error returned by fn as a Response,
+// with the status code 503 on error
+func JSONHandler(fn func(r *http.Request) (map[string]string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		details, err := fn(r)
+		resp := &Response{
+			Status:  "ok",
+			Details: details,
+		}
+		code := http.StatusOK
+		if err != nil {
+			resp.Status = "error"
+			resp.Error = err.Error()
+			code = http.StatusServiceUnavailable
+			glog.V(1).Infof("%s %s failed: %v", r.Method, r.URL.Path, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		err = json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			glog.Errorf("Cannot write %s %s response: %v", r.Method, r.URL.Path, err)
+		}
+	}
+}
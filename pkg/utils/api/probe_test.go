@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeHandler(t *testing.T) {
+	for _, tc := range []struct {
+		probe    Probe
+		code     int
+		response *Response
+	}{
+		{
+			probe: func() (map[string]string, error) {
+				return map[string]string{"a": "b"}, nil
+			},
+			code: http.StatusOK,
+			response: &Response{
+				Status:  "ok",
+				Details: map[string]string{"a": "b"},
+			},
+		},
+		{
+			probe: func() (map[string]string, error) {
+				return nil, fmt.Errorf("failed")
+			},
+			code: http.StatusServiceUnavailable,
+			response: &Response{
+				Status: "error",
+				Error:  "failed",
+			},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			probeHandler(tc.probe)(w, httptest.NewRequest("GET", healthzPath, nil))
+			assert.Equal(t, tc.code, w.Code)
+			resp := &Response{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(resp))
+			assert.Equal(t, tc.response, resp)
+		})
+	}
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	for addr, loopback := range map[string]bool{
+		"127.0.0.1:8485": true,
+		"[::1]:8485":     true,
+		"localhost:8485": true,
+		"0.0.0.0:8485":   false,
+		":8485":          false,
+		"10.0.0.1:8485":  false,
+		"127.0.0.1":      false,
+	} {
+		assert.Equal(t, loopback, IsLoopbackAddress(addr), addr)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"time"
@@ -15,13 +16,29 @@ const (
 	prometheusExporterPath = "/metrics"
 )
 
+// Route is an additional handler served with RegisterRoutes
+type Route struct {
+	Path    string
+	Method  string
+	Handler http.Handler
+}
+
 // RegisterAPI register:
 // - prometheus exporter
+// - the probes, if any, on the prometheus exporter bind address
 // - pprof
-func RegisterAPI(prometheusExporterBindAddress, pprofBind string) {
+func RegisterAPI(prometheusExporterBindAddress, pprofBind string, probes *Probes) {
 	if prometheusExporterBindAddress != "" {
 		promRouter := mux.NewRouter()
 		promRouter.Path(prometheusExporterPath).Methods("GET").Handler(promhttp.Handler())
+		if probes != nil && probes.Healthz != nil {
+			promRouter.Path(healthzPath).Methods("GET").Handler(probeHandler(probes.Healthz))
+			glog.V(0).Infof("Starting liveness probe on %s%s", prometheusExporterBindAddress, healthzPath)
+		}
+		if probes != nil && probes.Readyz != nil {
+			promRouter.Path(readyzPath).Methods("GET").Handler(probeHandler(probes.Readyz))
+			glog.V(0).Infof("Starting readiness probe on %s%s", prometheusExporterBindAddress, readyzPath)
+		}
 		promServer := &http.Server{
 			Handler:      promRouter,
 			Addr:         prometheusExporterBindAddress,
@@ -49,3 +66,38 @@ func RegisterAPI(prometheusExporterBindAddress, pprofBind string) {
 	glog.V(0).Infof("Starting pprof on %s/debug/pprof", pprofBind)
 	go pprofServer.ListenAndServe()
 }
+
+// RegisterRoutes serves the routes on their own listener, separated from the prometheus exporter
+func RegisterRoutes(bindAddress string, routes ...*Route) {
+	router := mux.NewRouter()
+	for _, route := range routes {
+		router.Path(route.Path).Methods(route.Method).Handler(route.Handler)
+		glog.V(0).Infof("Starting %s %s%s", route.Method, bindAddress, route.Path)
+	}
+	server := &http.Server{
+		Handler: router,
+		Addr:    bindAddress,
+		// the routes can take longer than the metrics and the probes
+		WriteTimeout: 2 * time.Minute,
+		ReadTimeout:  15 * time.Second,
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil {
+			glog.Errorf("Cannot serve the routes on %s: %v", bindAddress, err)
+		}
+	}()
+}
+
+// IsLoopbackAddress returns true when the ip:port or host:port binds a loopback interface only
+func IsLoopbackAddress(bindAddress string) bool {
+	host, _, err := net.SplitHostPort(bindAddress)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -3,6 +3,8 @@ package kubeclient
 import "github.com/golang/glog"
 
 import (
+	"fmt"
+	"os"
 	"time"
 
 	"k8s.io/client-go/kubernetes"
@@ -11,10 +13,58 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// DefaultTimeout of the requests to the kube-apiserver
+const DefaultTimeout = time.Second * 10
+
+// Config of the Kubernetes client
+type Config struct {
+	// KubeConfigPath is the kubeconfig file, when empty the InCluster config is used unless KubeConfigEnv is set
+	KubeConfigPath string
+	// KubeConfigEnv merges the files of the KUBECONFIG environment variable like kubectl does when KubeConfigPath is empty
+	KubeConfigEnv bool
+	// Context of the kubeconfig to use instead of its current-context
+	Context string
+
+	// Impersonate is the user to act as, with the ImpersonateGroups
+	Impersonate       string
+	ImpersonateGroups []string
+
+	// QPS and Burst of the requests to the kube-apiserver, the client-go defaults are used when zero
+	QPS   float32
+	Burst int
+	// Timeout of each request to the kube-apiserver, the DefaultTimeout is used when zero
+	Timeout time.Duration
+}
+
+// InCluster returns true when the InCluster config is used
+func (c *Config) InCluster() bool {
+	return c.KubeConfigPath == "" && !c.KubeConfigEnv
+}
+
+func (c *Config) validate() error {
+	if c.Context != "" && c.InCluster() {
+		return fmt.Errorf("cannot use the context %q with the InCluster config, a kubeconfig is required", c.Context)
+	}
+	if len(c.ImpersonateGroups) > 0 && c.Impersonate == "" {
+		return fmt.Errorf("cannot impersonate the groups %v without a user", c.ImpersonateGroups)
+	}
+	if c.QPS < 0 {
+		return fmt.Errorf("invalid value for QPS: %g", c.QPS)
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("invalid value for Burst: %d", c.Burst)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid value for Timeout: %s", c.Timeout)
+	}
+	return nil
+}
+
 // KubeClient state for a Kubernetes client (inCluster or regular one)
 type KubeClient struct {
 	KubeConfigPath string
 
+	conf       *Config
 	clientSet  *kubernetes.Clientset
 	certClient *certapi.CertificatesV1beta1Client
 	restConfig *rest.Config
@@ -22,10 +72,21 @@ type KubeClient struct {
 
 // NewKubeClient instantiate a new Kubernetes client, pass kubeConfigPath == "" to build an InCluster client
 func NewKubeClient(kubeConfigPath string) (*KubeClient, error) {
+	return NewKubeClientFromConfig(&Config{KubeConfigPath: kubeConfigPath})
+}
+
+// NewKubeClientFromConfig instantiate a new Kubernetes client, see Config.InCluster for the InCluster client
+func NewKubeClientFromConfig(conf *Config) (*KubeClient, error) {
+	err := conf.validate()
+	if err != nil {
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
 	c := &KubeClient{
-		KubeConfigPath: kubeConfigPath,
+		KubeConfigPath: conf.KubeConfigPath,
+		conf:           conf,
 	}
-	err := c.build()
+	err = c.build()
 	if err != nil {
 		return nil, err
 	}
@@ -43,11 +104,23 @@ func (k *KubeClient) buildInClusterConfig() error {
 	return nil
 }
 
-func (k *KubeClient) buildFlagsConfig() error {
-	glog.V(3).Infof("Building flags kube-config with %s", k.KubeConfigPath)
-	kubeConfig, err := clientcmd.BuildConfigFromFlags("", k.KubeConfigPath)
+// buildLoadingRulesConfig loads the KubeConfigPath or merges the files of the KUBECONFIG environment variable
+func (k *KubeClient) buildLoadingRulesConfig() error {
+	rules := &clientcmd.ClientConfigLoadingRules{}
+	if k.conf.KubeConfigEnv {
+		rules = clientcmd.NewDefaultClientConfigLoadingRules()
+	}
+	rules.ExplicitPath = k.conf.KubeConfigPath
+	if rules.ExplicitPath != "" {
+		glog.V(3).Infof("Building kube-config with %s", rules.ExplicitPath)
+	} else {
+		glog.V(3).Infof("Building kube-config with %s=%s", clientcmd.RecommendedConfigPathEnvVar, os.Getenv(clientcmd.RecommendedConfigPathEnvVar))
+	}
+	kubeConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: k.conf.Context,
+	}).ClientConfig()
 	if err != nil {
-		glog.Errorf("Fail to build flags config: %v", err)
+		glog.Errorf("Fail to build kube-config: %v", err)
 		return err
 	}
 	k.restConfig = kubeConfig
@@ -55,15 +128,31 @@ func (k *KubeClient) buildFlagsConfig() error {
 }
 
 func (k *KubeClient) build() error {
-	kubeConfigFn := k.buildFlagsConfig
-	if k.KubeConfigPath == "" {
+	kubeConfigFn := k.buildLoadingRulesConfig
+	if k.conf.InCluster() {
 		kubeConfigFn = k.buildInClusterConfig
 	}
 	err := kubeConfigFn()
 	if err != nil {
 		return err
 	}
-	k.restConfig.Timeout = time.Second * 10 // TODO conf this
+	k.restConfig.Timeout = k.conf.Timeout
+	if k.restConfig.Timeout == 0 {
+		k.restConfig.Timeout = DefaultTimeout
+	}
+	if k.conf.QPS > 0 {
+		k.restConfig.QPS = k.conf.QPS
+	}
+	if k.conf.Burst > 0 {
+		k.restConfig.Burst = k.conf.Burst
+	}
+	if k.conf.Impersonate != "" {
+		glog.V(2).Infof("Impersonating %s with the groups %v", k.conf.Impersonate, k.conf.ImpersonateGroups)
+		k.restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: k.conf.Impersonate,
+			Groups:   k.conf.ImpersonateGroups,
+		}
+	}
 	k.clientSet, err = kubernetes.NewForConfig(k.restConfig)
 	if err != nil {
 		glog.Errorf("Cannot create clientSet: %v", err)
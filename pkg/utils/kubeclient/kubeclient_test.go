@@ -0,0 +1,113 @@
+package kubeclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const kubeConfigTemplate = `apiVersion: v1
+kind: Config
+current-context: %[1]s
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://%[1]s.example.com:6443
+users:
+- name: %[1]s
+  user:
+    token: %[1]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+`
+
+func TestNewKubeClient(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	var files []string
+	for _, name := range []string{"first", "second"} {
+		file := path.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(file, []byte(fmt.Sprintf(kubeConfigTemplate, name)), 0600))
+		files = append(files, file)
+	}
+	previous, ok := os.LookupEnv(clientcmd.RecommendedConfigPathEnvVar)
+	defer func() {
+		if ok {
+			os.Setenv(clientcmd.RecommendedConfigPathEnvVar, previous)
+			return
+		}
+		os.Unsetenv(clientcmd.RecommendedConfigPathEnvVar)
+	}()
+	os.Setenv(clientcmd.RecommendedConfigPathEnvVar, strings.Join(files, string(os.PathListSeparator)))
+
+	for _, tc := range []struct {
+		name string
+		conf *Config
+		host string
+	}{
+		{
+			name: "current context of the first file",
+			conf: &Config{KubeConfigEnv: true},
+			host: "https://first.example.com:6443",
+		},
+		{
+			name: "context of the second file",
+			conf: &Config{KubeConfigEnv: true, Context: "second"},
+			host: "https://second.example.com:6443",
+		},
+		{
+			name: "explicit path",
+			conf: &Config{KubeConfigPath: files[1]},
+			host: "https://second.example.com:6443",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			k, err := NewKubeClientFromConfig(tc.conf)
+			require.NoError(t, err)
+			assert.Equal(t, tc.host, k.restConfig.Host)
+			assert.Equal(t, DefaultTimeout, k.restConfig.Timeout)
+		})
+	}
+
+	k, err := NewKubeClientFromConfig(&Config{
+		KubeConfigEnv:     true,
+		Impersonate:       "system:serviceaccount:kube-system:kube-csr",
+		ImpersonateGroups: []string{"system:serviceaccounts"},
+		QPS:               20,
+		Burst:             40,
+		Timeout:           time.Minute,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:kube-system:kube-csr", k.restConfig.Impersonate.UserName)
+	assert.Equal(t, []string{"system:serviceaccounts"}, k.restConfig.Impersonate.Groups)
+	assert.Equal(t, float32(20), k.restConfig.QPS)
+	assert.Equal(t, 40, k.restConfig.Burst)
+	assert.Equal(t, time.Minute, k.restConfig.Timeout)
+
+	_, err = NewKubeClientFromConfig(&Config{KubeConfigEnv: true, Context: "missing"})
+	assert.Error(t, err)
+	_, err = NewKubeClientFromConfig(&Config{KubeConfigEnv: true, ImpersonateGroups: []string{"system:masters"}})
+	assert.Error(t, err)
+
+	// the KUBECONFIG environment variable is ignored without KubeConfigEnv
+	assert.True(t, (&Config{}).InCluster())
+	_, err = NewKubeClientFromConfig(&Config{Context: "first"})
+	assert.Error(t, err)
+
+	k, err = NewKubeClient(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "https://first.example.com:6443", k.restConfig.Host)
+}
@@ -0,0 +1,236 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+)
+
+// Config of the Elector
+// - LeaseDuration: the followers wait this duration after the last observed change of the lease before acquiring it
+// - RenewDeadline: the leader stops leading when it cannot renew the lease during this duration
+// - RetryPeriod: the interval between each attempt to acquire or renew the lease
+type Config struct {
+	Identity      string
+	Namespace     string
+	Name          string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+
+	// OnLeadershipChange is called each time the Elector starts or stops leading
+	OnLeadershipChange func(leading bool)
+}
+
+// Elector state
+type Elector struct {
+	conf *Config
+	lock lock
+
+	mu             sync.RWMutex
+	leading        bool
+	observedRecord record
+	observedTime   time.Time
+}
+
+// NewElector creates a new Elector using a ConfigMap as lock
+func NewElector(kubeConfig *kubeclient.Config, conf *Config) (*Elector, error) {
+	if conf.RenewDeadline == 0 {
+		conf.RenewDeadline = conf.LeaseDuration * 2 / 3
+	}
+	if conf.RetryPeriod == 0 {
+		conf.RetryPeriod = conf.LeaseDuration / 7
+	}
+	err := validate(conf)
+	if err != nil {
+		glog.Errorf("Cannot use the provided config: %v", err)
+		return nil, err
+	}
+	k, err := kubeclient.NewKubeClientFromConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newElector(conf, &configMapLock{
+		namespace:  conf.Namespace,
+		name:       conf.Name,
+		kubeClient: k,
+	}), nil
+}
+
+func newElector(conf *Config, l lock) *Elector {
+	return &Elector{
+		conf: conf,
+		lock: l,
+	}
+}
+
+func validate(conf *Config) error {
+	if conf.Identity == "" {
+		return fmt.Errorf("empty leader election identity")
+	}
+	if conf.Namespace == "" || conf.Name == "" {
+		return fmt.Errorf("invalid leader election lock: namespace %q, name %q", conf.Namespace, conf.Name)
+	}
+	if conf.LeaseDuration <= conf.RenewDeadline {
+		return fmt.Errorf("the lease duration %s must be greater than the renew deadline %s", conf.LeaseDuration, conf.RenewDeadline)
+	}
+	if conf.RetryPeriod <= 0 || conf.RenewDeadline <= conf.RetryPeriod {
+		return fmt.Errorf("the renew deadline %s must be greater than the retry period %s", conf.RenewDeadline, conf.RetryPeriod)
+	}
+	return nil
+}
+
+// IsLeader returns if the Elector is currently leading
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	e.leading = leading
+	e.mu.Unlock()
+	if e.conf.OnLeadershipChange != nil {
+		e.conf.OnLeadershipChange(leading)
+	}
+}
+
+// tryAcquireOrRenew returns if the Elector holds the lease after the call
+// the expiration of the lease is measured with the local clock since the last observed change of the record
+func (e *Elector) tryAcquireOrRenew(now time.Time) bool {
+	desired := record{
+		HolderIdentity:       e.conf.Identity,
+		LeaseDurationSeconds: int(e.conf.LeaseDuration.Seconds()),
+		AcquireTime:          metav1.NewTime(now),
+		RenewTime:            metav1.NewTime(now),
+	}
+	current, err := e.lock.get()
+	if err != nil {
+		return false
+	}
+	if current == nil {
+		err = e.lock.create(&desired)
+		if err != nil {
+			glog.Errorf("Cannot create the lock %s: %v", e.lock.String(), err)
+			return false
+		}
+		e.observedRecord, e.observedTime = desired, now
+		return true
+	}
+	if *current != e.observedRecord {
+		e.observedRecord, e.observedTime = *current, now
+	}
+	if current.HolderIdentity != e.conf.Identity &&
+		current.HolderIdentity != "" &&
+		e.observedTime.Add(time.Duration(current.LeaseDurationSeconds)*time.Second).After(now) {
+		glog.V(2).Infof("Lock %s is held by %s", e.lock.String(), current.HolderIdentity)
+		return false
+	}
+	if current.HolderIdentity == e.conf.Identity {
+		desired.AcquireTime = current.AcquireTime
+		desired.LeaderTransitions = current.LeaderTransitions
+	} else {
+		desired.LeaderTransitions = current.LeaderTransitions + 1
+	}
+	err = e.lock.update(&desired)
+	if err != nil {
+		glog.Errorf("Cannot update the lock %s: %v", e.lock.String(), err)
+		return false
+	}
+	e.observedRecord, e.observedTime = desired, now
+	return true
+}
+
+// release gives up the lease to let a follower acquire it without waiting its expiration
+func (e *Elector) release() {
+	now := time.Now()
+	current, err := e.lock.get()
+	if err != nil || current == nil || current.HolderIdentity != e.conf.Identity {
+		return
+	}
+	released := *current
+	released.HolderIdentity = ""
+	released.LeaseDurationSeconds = 1
+	released.RenewTime = metav1.NewTime(now)
+	err = e.lock.update(&released)
+	if err != nil {
+		glog.Errorf("Cannot release the lock %s: %v", e.lock.String(), err)
+		return
+	}
+	glog.V(0).Infof("Released the lock %s", e.lock.String())
+}
+
+// acquire blocks until the lease is acquired, returns false when the context is done
+func (e *Elector) acquire(ctx context.Context) bool {
+	ticker := time.NewTicker(e.conf.RetryPeriod)
+	defer ticker.Stop()
+	glog.V(0).Infof("Standing by as %s, trying to acquire the lock %s every %s", e.conf.Identity, e.lock.String(), e.conf.RetryPeriod)
+	for {
+		if e.tryAcquireOrRenew(time.Now()) {
+			glog.V(0).Infof("Successfully acquired the lock %s as %s", e.lock.String(), e.conf.Identity)
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew blocks while the lease is renewed, returns when the context is done or the RenewDeadline is reached
+func (e *Elector) renew(ctx context.Context) {
+	ticker := time.NewTicker(e.conf.RetryPeriod)
+	defer ticker.Stop()
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if e.tryAcquireOrRenew(now) {
+			lastRenew = now
+			continue
+		}
+		if now.Sub(lastRenew) >= e.conf.RenewDeadline {
+			glog.Errorf("Cannot renew the lock %s since %s, stop leading", e.lock.String(), now.Sub(lastRenew).Round(time.Second))
+			return
+		}
+	}
+}
+
+// Run executes fn while leading, the context given to fn is cancelled once the leadership is lost
+// the Elector stands by again after a loss of the leadership, returns when the context is done
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	for {
+		if !e.acquire(ctx) {
+			return
+		}
+		e.setLeading(true)
+		leaderCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			// stop renewing the lease if fn returns before the loss of the leadership
+			defer cancel()
+			fn(leaderCtx)
+		}()
+		e.renew(leaderCtx)
+		cancel()
+		<-done
+		e.setLeading(false)
+		if ctx.Err() != nil {
+			e.release()
+			return
+		}
+	}
+}
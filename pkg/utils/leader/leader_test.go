@@ -0,0 +1,159 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryLock is a lock shared by the electors of a test
+type memoryLock struct {
+	mu      sync.Mutex
+	r       *record
+	version int
+}
+
+// electorLock binds the memoryLock to an elector to detect the concurrent updates
+type electorLock struct {
+	*memoryLock
+	version int
+}
+
+func (l *electorLock) String() string {
+	return "memory"
+}
+
+func (l *electorLock) get() (*record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version = l.memoryLock.version
+	if l.r == nil {
+		return nil, nil
+	}
+	r := *l.r
+	return &r, nil
+}
+
+func (l *electorLock) create(r *record) error {
+	return l.update(r)
+}
+
+func (l *electorLock) update(r *record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.version != l.memoryLock.version {
+		return fmt.Errorf("conflict")
+	}
+	c := *r
+	l.r = &c
+	l.memoryLock.version++
+	l.version = l.memoryLock.version
+	return nil
+}
+
+func newTestElector(identity string, m *memoryLock) *Elector {
+	return newElector(&Config{
+		Identity:      identity,
+		Namespace:     "kube-system",
+		Name:          "kube-csr",
+		LeaseDuration: time.Second * 15,
+		RenewDeadline: time.Second * 10,
+		RetryPeriod:   time.Second * 2,
+	}, &electorLock{memoryLock: m})
+}
+
+func TestTryAcquireOrRenew(t *testing.T) {
+	m := &memoryLock{}
+	a, b := newTestElector("a", m), newTestElector("b", m)
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.True(t, a.tryAcquireOrRenew(now))
+	assert.False(t, b.tryAcquireOrRenew(now))
+
+	// renewed by a
+	now = now.Add(time.Second * 10)
+	require.True(t, a.tryAcquireOrRenew(now))
+	assert.False(t, b.tryAcquireOrRenew(now))
+
+	// b observed the last renew 14s ago
+	now = now.Add(time.Second * 14)
+	assert.False(t, b.tryAcquireOrRenew(now))
+
+	// a stopped renewing, the lease expired
+	now = now.Add(time.Second * 2)
+	require.True(t, b.tryAcquireOrRenew(now))
+	assert.Equal(t, "b", m.r.HolderIdentity)
+	assert.Equal(t, 1, m.r.LeaderTransitions)
+	assert.False(t, a.tryAcquireOrRenew(now))
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		conf  *Config
+		valid bool
+	}{
+		{
+			conf: &Config{
+				Identity:      "a",
+				Namespace:     "kube-system",
+				Name:          "kube-csr",
+				LeaseDuration: time.Second * 15,
+				RenewDeadline: time.Second * 10,
+				RetryPeriod:   time.Second * 2,
+			},
+			valid: true,
+		},
+		{
+			conf: &Config{
+				Namespace:     "kube-system",
+				Name:          "kube-csr",
+				LeaseDuration: time.Second * 15,
+				RenewDeadline: time.Second * 10,
+				RetryPeriod:   time.Second * 2,
+			},
+		},
+		{
+			conf: &Config{
+				Identity:      "a",
+				Namespace:     "kube-system",
+				Name:          "kube-csr",
+				LeaseDuration: time.Second * 10,
+				RenewDeadline: time.Second * 10,
+				RetryPeriod:   time.Second * 2,
+			},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			assert.Equal(t, tc.valid, validate(tc.conf) == nil)
+		})
+	}
+}
+
+func TestRunRelease(t *testing.T) {
+	m := &memoryLock{}
+	e := newElector(&Config{
+		Identity:      "a",
+		LeaseDuration: time.Second * 15,
+		RenewDeadline: time.Second * 10,
+		RetryPeriod:   time.Millisecond * 10,
+	}, &electorLock{memoryLock: m})
+
+	var changes []bool
+	e.conf.OnLeadershipChange = func(leading bool) {
+		changes = append(changes, leading)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.Run(ctx, func(leaderCtx context.Context) {
+		assert.True(t, e.IsLeader())
+		cancel()
+		<-leaderCtx.Done()
+	})
+	assert.False(t, e.IsLeader())
+	assert.Equal(t, []bool{true, false}, changes)
+	assert.Equal(t, "", m.r.HolderIdentity)
+}
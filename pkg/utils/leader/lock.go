@@ -0,0 +1,120 @@
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/kubeclient"
+)
+
+// LeaderAnnotation stores the record of the lease on the lock ConfigMap, compatible with the client-go ConfigMapLock
+const LeaderAnnotation = "control-plane.alpha.kubernetes.io/leader"
+
+// record is the lease held by the leader
+type record struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// lock stores the record of the lease, the update fails if the record changed since the get
+type lock interface {
+	get() (*record, error)
+	create(r *record) error
+	update(r *record) error
+	String() string
+}
+
+// configMapLock stores the record in an annotation of a ConfigMap
+// a coordination.k8s.io Lease would be the natural lock but the vendored client-go doesn't provide the coordination API,
+// the annotation keeps the record readable by the client-go ConfigMapLock of the later releases
+type configMapLock struct {
+	namespace  string
+	name       string
+	kubeClient *kubeclient.KubeClient
+
+	cm *v1.ConfigMap
+}
+
+func (l *configMapLock) String() string {
+	return fmt.Sprintf("configmap/%s in namespace %s", l.name, l.namespace)
+}
+
+// get returns a nil record when the ConfigMap or its annotation doesn't exist
+func (l *configMapLock) get() (*record, error) {
+	cm, err := l.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(l.namespace).Get(l.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		l.cm = nil
+		return nil, nil
+	}
+	if err != nil {
+		glog.Errorf("Cannot get the lock %s: %v", l.String(), err)
+		return nil, err
+	}
+	l.cm = cm
+	b, ok := cm.Annotations[LeaderAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	r := &record{}
+	err = json.Unmarshal([]byte(b), r)
+	if err != nil {
+		glog.Errorf("Cannot parse the annotation %s of the lock %s: %v", LeaderAnnotation, l.String(), err)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (l *configMapLock) create(r *record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if l.cm != nil {
+		// the ConfigMap exists without the annotation
+		return l.update(r)
+	}
+	cm, err := l.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(l.namespace).Create(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.name,
+			Namespace: l.namespace,
+			Annotations: map[string]string{
+				LeaderAnnotation: string(b),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+// update relies on the resourceVersion of the last get to fail on concurrent updates
+func (l *configMapLock) update(r *record) error {
+	if l.cm == nil {
+		return fmt.Errorf("lock %s not initialized", l.String())
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	cm := l.cm.DeepCopy()
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Annotations[LeaderAnnotation] = string(b)
+	cm, err = l.kubeClient.GetKubernetesClient().CoreV1().ConfigMaps(l.namespace).Update(cm)
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
@@ -0,0 +1,69 @@
+// Package pemtest generates the keys, requests and certificates of the tests
+package pemtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+)
+
+// GenerateKeyOrDie returns a new 1024 bits RSA private key, small to keep the tests fast
+func GenerateKeyOrDie() *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	return privateKey
+}
+
+// EncodeKey returns the PEM of the private key
+func EncodeKey(privateKey *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+}
+
+// GenerateRequestOrDie returns the PEM of a certificate request for the common name and the DNS names
+func GenerateRequestOrDie(privateKey *rsa.PrivateKey, commonName string, dnsNames ...string) []byte {
+	return GenerateRequestFromTemplateOrDie(privateKey, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	})
+}
+
+// GenerateRequestFromTemplateOrDie returns the PEM of the certificate request of the template
+func GenerateRequestFromTemplateOrDie(privateKey *rsa.PrivateKey, template *x509.CertificateRequest) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// GenerateCertOrDie returns the PEM of a self-signed certificate for the common name and the DNS names,
+// valid the 30 days before notAfter
+func GenerateCertOrDie(privateKey *rsa.PrivateKey, commonName string, notAfter time.Time, dnsNames ...string) []byte {
+	return GenerateCertFromTemplateOrDie(privateKey, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notAfter.Add(-time.Hour * 24 * 30),
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+	})
+}
+
+// GenerateCertFromTemplateOrDie returns the PEM of the certificate of the template signed by the private key,
+// the certificate is self-signed without an Issuer in the template
+func GenerateCertFromTemplateOrDie(privateKey *rsa.PrivateKey, template *x509.Certificate) []byte {
+	parent := template
+	if template.Issuer.CommonName != "" {
+		parent = &x509.Certificate{Subject: template.Issuer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, privateKey.Public(), privateKey)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,90 @@
+package pemio
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// ParseCertificate decodes the first pem block as a certificate
+func ParseCertificate(b []byte) (*x509.Certificate, error) {
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, fmt.Errorf("cannot decode certificate")
+	}
+	return x509.ParseCertificate(p.Bytes)
+}
+
+// ParseCertificateRequest decodes the first pem block as a certificate request
+func ParseCertificateRequest(b []byte) (*x509.CertificateRequest, error) {
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, fmt.Errorf("cannot decode certificate request")
+	}
+	return x509.ParseCertificateRequest(p.Bytes)
+}
+
+// ReadCertificate reads and parses the pem certificate file
+func ReadCertificate(absPath string) (*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ParseCertificate(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse certificate %s: %v", absPath, err)
+	}
+	return cert, nil
+}
+
+// ParsePrivateKey decodes the first pem block as a PKCS1, EC or PKCS8 private key
+func ParsePrivateKey(b []byte) (crypto.Signer, error) {
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, fmt.Errorf("cannot decode private key")
+	}
+	switch p.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(p.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(p.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// ReadPrivateKey reads and parses the pem private key file
+func ReadPrivateKey(absPath string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key %s: %v", absPath, err)
+	}
+	return key, nil
+}
+
+// MatchPublicKey returns if both public keys are the same
+func MatchPublicKey(a, b crypto.PublicKey) (bool, error) {
+	aBytes, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false, err
+	}
+	bBytes, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aBytes, bBytes), nil
+}
@@ -0,0 +1,96 @@
+package pemio
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPrivateKey(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecBytes, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		pemType string
+		b       []byte
+		err     bool
+	}{
+		{
+			name:    "rsa",
+			pemType: "RSA PRIVATE KEY",
+			b:       x509.MarshalPKCS1PrivateKey(rsaKey),
+		},
+		{
+			name:    "ec",
+			pemType: "EC PRIVATE KEY",
+			b:       ecBytes,
+		},
+		{
+			name:    "corrupted",
+			pemType: "RSA PRIVATE KEY",
+			b:       []byte("123"),
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := path.Join(tempDir, tc.name)
+			require.NoError(t, WritePem(tc.b, tc.pemType, p, 0600, false))
+			key, err := ReadPrivateKey(p)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, key.Public())
+		})
+	}
+	_, err = ReadPrivateKey(path.Join(tempDir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadCertificate(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	require.NoError(t, err)
+
+	p := path.Join(tempDir, "a.certificate")
+	require.NoError(t, ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	cert, err := ReadCertificate(p)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), cert.SerialNumber.Int64())
+
+	require.NoError(t, ioutil.WriteFile(p, []byte("corrupted"), 0600))
+	_, err = ReadCertificate(p)
+	assert.Error(t, err)
+}
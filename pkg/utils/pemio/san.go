@@ -0,0 +1,12 @@
+package pemio
+
+import "net"
+
+// SubjectAlternativeNames returns the DNS names then the IP addresses of a certificate or a certificate request
+func SubjectAlternativeNames(dnsNames []string, ips []net.IP) []string {
+	sans := append([]string{}, dnsNames...)
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
@@ -0,0 +1,19 @@
+package pemio
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectAlternativeNames(t *testing.T) {
+	assert.Empty(t, SubjectAlternativeNames(nil, nil))
+	dnsNames := []string{"app.svc"}
+	sans := SubjectAlternativeNames(dnsNames, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")})
+	assert.Equal(t, []string{"app.svc", "10.0.0.1", "::1"}, sans)
+
+	// the DNS names are copied
+	sans[0] = "changed"
+	assert.Equal(t, []string{"app.svc"}, dnsNames)
+}
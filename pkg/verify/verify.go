@@ -0,0 +1,184 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio"
+)
+
+// Config contains the files to verify and their maximum permissions, an empty path skips its checks
+// a zero permission skips the permission check of the file
+type Config struct {
+	PrivateKeyABSPath  string
+	CSRABSPath         string
+	CertificateABSPath string
+
+	PrivateKeyPermission  os.FileMode
+	CSRPermission         os.FileMode
+	CertificatePermission os.FileMode
+
+	// AllowMissingCertificate skips the checks of a missing certificate, like before its first issue
+	AllowMissingCertificate bool
+	// CertificatePermissionOnly skips the checks of the content of the certificate, only its permissions are checked
+	CertificatePermissionOnly bool
+}
+
+// Error lists the failed checks
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return strings.Join(e.Problems, ", ")
+}
+
+func (e *Error) add(format string, a ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, a...))
+}
+
+// Verify checks the permissions of the files, that the csr is signed by the private key,
+// that the certificate matches the private key and that its common name and SANs are the ones of the csr
+// all the failed checks are returned as an *Error
+func Verify(conf *Config) error {
+	e := &Error{}
+	var verified []string
+	var key crypto.Signer
+	if conf.PrivateKeyABSPath != "" && checkPermission(e, conf.PrivateKeyABSPath, conf.PrivateKeyPermission, false) {
+		verified = append(verified, conf.PrivateKeyABSPath)
+		var err error
+		key, err = pemio.ReadPrivateKey(conf.PrivateKeyABSPath)
+		if err != nil {
+			e.add("%v", err)
+		}
+	}
+	var req *x509.CertificateRequest
+	if conf.CSRABSPath != "" && checkPermission(e, conf.CSRABSPath, conf.CSRPermission, false) {
+		verified = append(verified, conf.CSRABSPath)
+		req = verifyCSR(e, conf, key)
+	}
+	if conf.CertificateABSPath != "" && checkPermission(e, conf.CertificateABSPath, conf.CertificatePermission, conf.AllowMissingCertificate) {
+		verified = append(verified, conf.CertificateABSPath)
+		if !conf.CertificatePermissionOnly {
+			verifyCertificate(e, conf, key, req)
+		}
+	}
+	if len(e.Problems) > 0 {
+		glog.Errorf("Failed verify: %v", e)
+		return e
+	}
+	glog.V(0).Infof("Successfully verified %s", strings.Join(verified, ", "))
+	return nil
+}
+
+// checkPermission returns if the file exists, its permissions must not be looser than the maximum one
+func checkPermission(e *Error, absPath string, max os.FileMode, allowMissing bool) bool {
+	fi, err := os.Stat(absPath)
+	if os.IsNotExist(err) && allowMissing {
+		glog.V(1).Infof("Skipping the verify of the missing %s", absPath)
+		return false
+	}
+	if err != nil {
+		e.add("%v", err)
+		return false
+	}
+	if max != 0 && fi.Mode().Perm()&^max.Perm() != 0 {
+		e.add("%s has the permissions %04o looser than %04o", absPath, fi.Mode().Perm(), max.Perm())
+	}
+	return true
+}
+
+// verifyCSR checks the signature of the csr with its public key, the one of the private key
+func verifyCSR(e *Error, conf *Config, key crypto.Signer) *x509.CertificateRequest {
+	req, err := readCertificateRequest(conf.CSRABSPath)
+	if err != nil {
+		e.add("%v", err)
+		return nil
+	}
+	err = req.CheckSignature()
+	if err != nil {
+		e.add("csr %s has an invalid signature: %v", conf.CSRABSPath, err)
+	}
+	if key == nil {
+		return req
+	}
+	match, err := pemio.MatchPublicKey(req.PublicKey, key.Public())
+	if err != nil {
+		e.add("cannot compare the csr %s with the private key %s: %v", conf.CSRABSPath, conf.PrivateKeyABSPath, err)
+		return req
+	}
+	if !match {
+		e.add("csr %s is not signed by the private key %s", conf.CSRABSPath, conf.PrivateKeyABSPath)
+	}
+	return req
+}
+
+// verifyCertificate checks the public key of the certificate with the private key, its common name and SANs with the csr
+func verifyCertificate(e *Error, conf *Config, key crypto.Signer, req *x509.CertificateRequest) {
+	cert, err := pemio.ReadCertificate(conf.CertificateABSPath)
+	if err != nil {
+		e.add("%v", err)
+		return
+	}
+	if key != nil {
+		match, err := pemio.MatchPublicKey(cert.PublicKey, key.Public())
+		if err != nil {
+			e.add("cannot compare the certificate %s with the private key %s: %v", conf.CertificateABSPath, conf.PrivateKeyABSPath, err)
+		} else if !match {
+			e.add("certificate %s does not match the private key %s", conf.CertificateABSPath, conf.PrivateKeyABSPath)
+		}
+	}
+	if req == nil {
+		return
+	}
+	if cert.Subject.CommonName != req.Subject.CommonName {
+		e.add("certificate %s has the common name %q instead of %q requested by the csr %s", conf.CertificateABSPath, cert.Subject.CommonName, req.Subject.CommonName, conf.CSRABSPath)
+	}
+	missing, unexpected := diff(pemio.SubjectAlternativeNames(req.DNSNames, req.IPAddresses), pemio.SubjectAlternativeNames(cert.DNSNames, cert.IPAddresses))
+	if len(missing) > 0 {
+		e.add("certificate %s is missing the SANs %s requested by the csr %s", conf.CertificateABSPath, strings.Join(missing, ","), conf.CSRABSPath)
+	}
+	if len(unexpected) > 0 {
+		e.add("certificate %s has the SANs %s not requested by the csr %s", conf.CertificateABSPath, strings.Join(unexpected, ","), conf.CSRABSPath)
+	}
+}
+
+func readCertificateRequest(absPath string) (*x509.CertificateRequest, error) {
+	b, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	req, err := pemio.ParseCertificateRequest(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse csr %s: %v", absPath, err)
+	}
+	return req, nil
+}
+
+// diff returns the elements of a missing in b and the elements of b not in a
+func diff(a, b []string) (missing, unexpected []string) {
+	inA, inB := make(map[string]struct{}, len(a)), make(map[string]struct{}, len(b))
+	for _, s := range a {
+		inA[s] = struct{}{}
+	}
+	for _, s := range b {
+		inB[s] = struct{}{}
+		_, ok := inA[s]
+		if !ok {
+			unexpected = append(unexpected, s)
+		}
+	}
+	for _, s := range a {
+		_, ok := inB[s]
+		if !ok {
+			missing = append(missing, s)
+		}
+	}
+	return missing, unexpected
+}
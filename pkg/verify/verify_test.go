@@ -0,0 +1,125 @@
+package verify
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JulienBalestra/kube-csr/pkg/utils/pemio/pemtest"
+)
+
+func TestVerify(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "kube-csr-tests-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	key, otherKey := pemtest.GenerateKeyOrDie(), pemtest.GenerateKeyOrDie()
+	keyPath, csrPath, certPath := path.Join(tempDir, "app.private_key"), path.Join(tempDir, "app.csr"), path.Join(tempDir, "app.certificate")
+	otherKeyPath, otherCertPath := path.Join(tempDir, "other.private_key"), path.Join(tempDir, "other.certificate")
+	for p, b := range map[string][]byte{
+		keyPath:       pemtest.EncodeKey(key),
+		csrPath:       pemtest.GenerateRequestOrDie(key, "app", "app.svc"),
+		certPath:      pemtest.GenerateCertOrDie(key, "app", time.Now().Add(time.Hour), "app.svc"),
+		otherKeyPath:  pemtest.EncodeKey(otherKey),
+		otherCertPath: pemtest.GenerateCertOrDie(key, "other", time.Now().Add(time.Hour), "other.svc"),
+	} {
+		require.NoError(t, ioutil.WriteFile(p, b, 0600))
+	}
+	looseKeyPath := path.Join(tempDir, "loose.private_key")
+	require.NoError(t, ioutil.WriteFile(looseKeyPath, pemtest.EncodeKey(key), 0644))
+	require.NoError(t, os.Chmod(looseKeyPath, 0644))
+
+	for _, tc := range []struct {
+		name     string
+		conf     *Config
+		problems []string
+	}{
+		{
+			name: "ok",
+			conf: &Config{
+				PrivateKeyABSPath:     keyPath,
+				CSRABSPath:            csrPath,
+				CertificateABSPath:    certPath,
+				PrivateKeyPermission:  0600,
+				CSRPermission:         0600,
+				CertificatePermission: 0644,
+			},
+		},
+		{
+			name: "missing certificate allowed",
+			conf: &Config{
+				PrivateKeyABSPath:       keyPath,
+				CSRABSPath:              csrPath,
+				CertificateABSPath:      path.Join(tempDir, "missing.certificate"),
+				AllowMissingCertificate: true,
+			},
+		},
+		{
+			name: "missing certificate",
+			conf: &Config{
+				CertificateABSPath: path.Join(tempDir, "missing.certificate"),
+			},
+			problems: []string{"stat " + path.Join(tempDir, "missing.certificate") + ": no such file or directory"},
+		},
+		{
+			name: "loose permissions",
+			conf: &Config{
+				PrivateKeyABSPath:    looseKeyPath,
+				CSRABSPath:           csrPath,
+				PrivateKeyPermission: 0600,
+			},
+			problems: []string{looseKeyPath + " has the permissions 0644 looser than 0600"},
+		},
+		{
+			name: "other private key",
+			conf: &Config{
+				PrivateKeyABSPath:  otherKeyPath,
+				CSRABSPath:         csrPath,
+				CertificateABSPath: certPath,
+			},
+			problems: []string{
+				"csr " + csrPath + " is not signed by the private key " + otherKeyPath,
+				"certificate " + certPath + " does not match the private key " + otherKeyPath,
+			},
+		},
+		{
+			name: "other certificate",
+			conf: &Config{
+				PrivateKeyABSPath:  keyPath,
+				CSRABSPath:         csrPath,
+				CertificateABSPath: otherCertPath,
+			},
+			problems: []string{
+				"certificate " + otherCertPath + " has the common name \"other\" instead of \"app\" requested by the csr " + csrPath,
+				"certificate " + otherCertPath + " is missing the SANs app.svc requested by the csr " + csrPath,
+				"certificate " + otherCertPath + " has the SANs other.svc not requested by the csr " + csrPath,
+			},
+		},
+		{
+			name: "certificate permissions only",
+			conf: &Config{
+				PrivateKeyABSPath:         keyPath,
+				CSRABSPath:                csrPath,
+				CertificateABSPath:        otherCertPath,
+				CertificatePermission:     0400,
+				CertificatePermissionOnly: true,
+			},
+			problems: []string{otherCertPath + " has the permissions 0600 looser than 0400"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.conf)
+			if tc.problems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.problems, err.(*Error).Problems)
+		})
+	}
+}